@@ -3,17 +3,39 @@
 
 package coagent
 
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
 // Agent is a purpose-built AI that uses models and calls tools.
 //
 // It's suggested that each instance has a dedicated life-time agent,
 // and should be shutdown while the instance shutdown. So that different instances
 // could run with different version of the assistance.
+//
+// An Agent must not be modified while it's running. Use Clone to derive a variant
+// of a shared Agent instead.
 type Agent struct {
 	Name         string
 	Description  string
 	Model        string
 	Instructions string
 	Tools        []Tool
+	// Metadata are the key-value pairs attached to the agent on the provider side.
+	Metadata map[string]string
+
+	// FallbackModels are the models to run with in order if the model is unavailable,
+	// i.e. the Runner returns an error wrapping ErrModelUnavailable.
+	FallbackModels []string
+	// OnFallback is called before running with the next fallback model, e.g. to log a warning.
+	// If it's nil, the fallback is not reported.
+	OnFallback func(ctx context.Context, event FallbackEvent)
 
 	// It provides a different Runner than the default one set by SetDefaultRunner.
 	Runner Runner
@@ -21,3 +43,167 @@ type Agent struct {
 	// and can be overridden by options passed to Run.
 	Options []RunOption
 }
+
+// Clone returns a copy of the Agent which does not share slices with the original,
+// so it could be modified without affecting the original.
+func (a Agent) Clone() Agent {
+	a.FallbackModels = slices.Clone(a.FallbackModels)
+	a.Tools = slices.Clone(a.Tools)
+	a.Metadata = maps.Clone(a.Metadata)
+	a.Options = slices.Clone(a.Options)
+
+	return a
+}
+
+// WithOverrides returns a variant of the Agent which runs with the provided overrides,
+// e.g. a different model or a subset of tools per request, while sharing the agent on the provider side.
+func (a Agent) WithOverrides(overrides Overrides) Agent {
+	agent := a.Clone()
+	agent.Options = append(agent.Options, WithOverrides(overrides))
+
+	return agent
+}
+
+// FallbackEvent is the event of a run falling back to the next model of Agent.FallbackModels.
+type FallbackEvent struct {
+	Agent string
+	// Model is the unavailable model.
+	Model    string
+	Fallback string
+	// Err is the error returned by the Runner for the unavailable model.
+	Err error
+}
+
+// Overrides are the changes to an Agent for a run. Zero fields are not changed.
+type Overrides struct {
+	Model string
+	// AdditionalInstructions are appended to the instructions of the agent.
+	AdditionalInstructions string
+	// Tools replace the tools of the agent if it's not nil, e.g. with a subset of them.
+	Tools []Tool
+}
+
+// Apply returns a copy of the provided agent with the overrides applied.
+func (o Overrides) Apply(agent Agent) Agent {
+	agent = agent.Clone()
+	if o.Model != "" {
+		agent.Model = o.Model
+	}
+	if o.AdditionalInstructions != "" {
+		agent.Instructions = strings.TrimSpace(agent.Instructions + "\n\n" + o.AdditionalInstructions)
+	}
+	if o.Tools != nil {
+		agent.Tools = slices.Clone(o.Tools)
+	}
+
+	return agent
+}
+
+// Run executes the provided messages with the Agent and returns the response message.
+//
+// If the context carries a correlation ID (see WithCorrelationID), the run is stamped with metadata
+// of the correlation ID and the version of this package.
+//
+// It returns an error wrapping ErrInvalidMessage without running if any image has unsupported detail,
+// while other limits of messages are only validated by Guardrail.
+//
+// It's safe to call Run concurrently on the same Agent,
+// since the Runner receives its own copy of the Agent for each run.
+func (a Agent) Run(ctx context.Context, messages []Message, opts ...RunOption) (Message, error) {
+	runner := a.Runner
+	if runner == nil {
+		runner = *defaultRunner.Load()
+	}
+
+	agent := a.Clone()
+	opts = append(slices.Clone(agent.Options), opts...)
+	// The options of the agent are merged, so the runner must not apply them again.
+	agent.Options = nil
+	if metadata := runMetadata(ctx); metadata != nil {
+		// Stamp the metadata first so the options could override it.
+		opts = append([]RunOption{WithMetadata(metadata)}, opts...)
+	}
+	config, err := NewRunConfig(opts)
+	if err != nil {
+		return Message{}, fmt.Errorf("run agent %s: %w", agent.Name, err)
+	}
+	// The zero limits only validate the detail of images.
+	if err = (MessageLimits{}).Validate(messages); err != nil {
+		return Message{}, fmt.Errorf("run agent %s: %w", agent.Name, err)
+	}
+
+	// Nested runs are limited by the smaller of the inherited limit and their own.
+	nesting := runNestingFrom(ctx)
+	nesting.depth++
+	nesting.maxDepth = min(cmp.Or(nesting.maxDepth, defaultMaxDepth), cmp.Or(config.MaxDepth, defaultMaxDepth))
+	if nesting.depth > nesting.maxDepth {
+		return Message{}, fmt.Errorf("run agent %s at depth %d: %w", agent.Name, nesting.depth, ErrMaxDepthExceeded)
+	}
+	ctx = context.WithValue(ctx, runNestingKey{}, nesting)
+
+	if config.JSONMode && !strings.Contains(strings.ToLower(agent.Instructions), "json") {
+		agent.Instructions = strings.TrimSpace(agent.Instructions + "\n\n" + jsonModeInstructions)
+	}
+	if config.Locale != "" {
+		agent.Instructions = strings.TrimSpace(agent.Instructions + "\n\n" + localeInstructions(config.Locale))
+	}
+
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, config.Timeout, ErrRunTimeout)
+		defer cancel()
+	}
+
+	// Images could only be read once, so they are buffered for the runs with fallback models.
+	runMessages := func() []Message { return messages }
+	if len(agent.FallbackModels) > 0 {
+		if runMessages, err = replayableMessages(messages); err != nil {
+			return Message{}, fmt.Errorf("run agent %s: %w", agent.Name, err)
+		}
+	}
+
+	message, err := runner.Run(ctx, agent, runMessages(), opts)
+	model := cmp.Or(config.Overrides.Model, agent.Model)
+	for _, fallback := range agent.FallbackModels {
+		if !errors.Is(err, ErrModelUnavailable) {
+			break
+		}
+
+		if agent.OnFallback != nil {
+			agent.OnFallback(ctx, FallbackEvent{Agent: agent.Name, Model: model, Fallback: fallback, Err: err})
+		}
+		model = fallback
+		agent.Model = fallback
+		message, err = runner.Run(ctx, agent, runMessages(), append(slices.Clip(opts), WithOverrides(Overrides{Model: model})))
+	}
+	if err != nil {
+		if errors.Is(context.Cause(ctx), ErrRunTimeout) && !errors.Is(err, ErrRunTimeout) {
+			err = fmt.Errorf("%w: %w", ErrRunTimeout, err)
+		}
+
+		return Message{}, fmt.Errorf("run agent %s: %w", agent.Name, err)
+	}
+
+	return message, nil
+}
+
+const (
+	jsonModeInstructions = "Respond with a valid JSON object."
+	defaultMaxDepth      = 8
+)
+
+// runNesting is the nesting of the agent runs carried by the context.
+type runNesting struct {
+	// depth is greater than 0 if an agent is run by another agent.
+	depth int
+	// maxDepth is the effective limit of the depth, which nested runs could only lower.
+	maxDepth int
+}
+
+type runNestingKey struct{}
+
+func runNestingFrom(ctx context.Context) runNesting {
+	nesting, _ := ctx.Value(runNestingKey{}).(runNesting)
+
+	return nesting
+}
@@ -0,0 +1,335 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent_test
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ktong/coagent"
+	"github.com/ktong/coagent/internal/assert"
+)
+
+func TestAgent_Run_metadata(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		description string
+		ctx         context.Context //nolint:containedctx
+		opts        []coagent.RunOption
+		metadata    map[string]string
+	}{
+		{
+			description: "no correlation ID",
+			ctx:         context.Background(),
+		},
+		{
+			description: "correlation ID",
+			ctx:         coagent.WithCorrelationID(context.Background(), "request"),
+			metadata:    map[string]string{coagent.MetadataCorrelationID: "request", coagent.MetadataVersion: "(devel)"},
+		},
+		{
+			description: "caller metadata",
+			ctx:         coagent.WithCorrelationID(context.Background(), "request"),
+			opts:        []coagent.RunOption{coagent.WithMetadata(map[string]string{coagent.MetadataCorrelationID: "run"})},
+			metadata:    map[string]string{coagent.MetadataCorrelationID: "run", coagent.MetadataVersion: "(devel)"},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			agent := coagent.Agent{
+				Name: "agent",
+				Runner: coagent.RunnerFunc(func(
+					_ context.Context, _ coagent.Agent, _ []coagent.Message, opts []coagent.RunOption,
+				) (coagent.Message, error) {
+					config, err := coagent.NewRunConfig(opts)
+					assert.NoError(t, err)
+					assert.Equal(t, testcase.metadata, config.Metadata)
+
+					return coagent.Message{}, nil
+				}),
+			}
+			_, err := agent.Run(testcase.ctx, nil, testcase.opts...)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAgent_Run_timeout(t *testing.T) {
+	t.Parallel()
+
+	agent := coagent.Agent{
+		Name: "agent",
+		Runner: coagent.RunnerFunc(func(
+			ctx context.Context, _ coagent.Agent, _ []coagent.Message, _ []coagent.RunOption,
+		) (coagent.Message, error) {
+			<-ctx.Done()
+
+			return coagent.Message{}, fmt.Errorf("cancel run: %w", ctx.Err())
+		}),
+	}
+	_, err := agent.Run(context.Background(), nil, coagent.WithRunTimeout(time.Millisecond))
+	assert.Equal(t, true, errors.Is(err, coagent.ErrRunTimeout))
+	assert.EqualError(t, err, "run agent agent: run timeout: cancel run: context deadline exceeded")
+}
+
+func TestAgent_Run_options(t *testing.T) {
+	t.Parallel()
+
+	agent := coagent.Agent{
+		Name: "agent",
+		Runner: coagent.RunnerFunc(func(
+			_ context.Context, agent coagent.Agent, _ []coagent.Message, opts []coagent.RunOption,
+		) (coagent.Message, error) {
+			assert.Equal(t, 0, len(agent.Options))
+			config, err := coagent.NewRunConfig(opts)
+			assert.NoError(t, err)
+			assert.Equal(t, 20, config.MaxTokens)
+			assert.Equal(t, "bob", config.User)
+
+			return coagent.Message{}, nil
+		}),
+		Options: []coagent.RunOption{coagent.WithMaxTokens(10), coagent.WithUser("bob")},
+	}
+	_, err := agent.Run(context.Background(), nil, coagent.WithMaxTokens(20))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(agent.Options))
+}
+
+func TestAgent_Run_imageDetail(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		description string
+		detail      coagent.ImageDetail
+		err         string
+	}{
+		{description: "empty detail"},
+		{description: "supported detail", detail: coagent.DetailHigh},
+		{
+			description: "unsupported detail",
+			detail:      "ultra",
+			err:         `run agent agent: invalid message: message 0 has an image with unsupported detail "ultra"`,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			agent := coagent.Agent{
+				Name: "agent",
+				Runner: coagent.RunnerFunc(func(context.Context, coagent.Agent, []coagent.Message, []coagent.RunOption) (coagent.Message, error) {
+					return coagent.Message{}, nil
+				}),
+			}
+			_, err := agent.Run(context.Background(), []coagent.Message{
+				{Role: coagent.RoleUser, Content: []coagent.Content{coagent.Image{Detail: testcase.detail}}},
+			})
+			if testcase.err != "" {
+				assert.EqualError(t, err, testcase.err)
+
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAgent_Run_fallback(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		description string
+		fallbacks   []string
+		available   string
+		models      []string
+		err         string
+	}{
+		{
+			description: "available model",
+			fallbacks:   []string{"m2"},
+			available:   "m1",
+			models:      []string{"m1"},
+		},
+		{
+			description: "fallback model",
+			fallbacks:   []string{"m2", "m3"},
+			available:   "m3",
+			models:      []string{"m1", "m2", "m3"},
+		},
+		{
+			description: "no available model",
+			fallbacks:   []string{"m2"},
+			models:      []string{"m1", "m2"},
+			err:         "run agent agent: m2: model unavailable",
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			var models, fallbacks []string
+			agent := coagent.Agent{
+				Name:           "agent",
+				Model:          "m1",
+				FallbackModels: testcase.fallbacks,
+				OnFallback: func(_ context.Context, event coagent.FallbackEvent) {
+					assert.Equal(t, "agent", event.Agent)
+					assert.Equal(t, models[len(models)-1], event.Model)
+					assert.Equal(t, true, errors.Is(event.Err, coagent.ErrModelUnavailable))
+					fallbacks = append(fallbacks, event.Fallback)
+				},
+				Runner: coagent.RunnerFunc(func(
+					_ context.Context, agent coagent.Agent, messages []coagent.Message, opts []coagent.RunOption,
+				) (coagent.Message, error) {
+					config, err := coagent.NewRunConfig(opts)
+					assert.NoError(t, err)
+					assert.Equal(t, agent.Model, cmp.Or(config.Overrides.Model, agent.Model))
+					models = append(models, agent.Model)
+
+					// Each run must read the entire image.
+					image, _ := messages[0].Content[0].(coagent.Image)
+					data, err := io.ReadAll(image.Image)
+					assert.NoError(t, err)
+					assert.Equal(t, "image", string(data))
+
+					if agent.Model != testcase.available {
+						return coagent.Message{}, fmt.Errorf("%s: %w", agent.Model, coagent.ErrModelUnavailable)
+					}
+
+					return coagent.Message{}, nil
+				}),
+			}
+			_, err := agent.Run(context.Background(), []coagent.Message{
+				{Role: coagent.RoleUser, Content: []coagent.Content{coagent.Image{Image: strings.NewReader("image")}}},
+			})
+			if testcase.err != "" {
+				assert.EqualError(t, err, testcase.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, testcase.models, models)
+			assert.Equal(t, testcase.models, append([]string{"m1"}, fallbacks...))
+		})
+	}
+}
+
+func TestAgent_Run_maxDepth(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		description string
+		outer       []coagent.RunOption
+		inner       []coagent.RunOption
+		runs        int
+	}{
+		{description: "default depth", runs: 8},
+		{description: "outer depth", outer: []coagent.RunOption{coagent.WithMaxDepth(2)}, runs: 2},
+		{
+			description: "inner depth lower than outer depth",
+			outer:       []coagent.RunOption{coagent.WithMaxDepth(4)},
+			inner:       []coagent.RunOption{coagent.WithMaxDepth(3)},
+			runs:        3,
+		},
+		{
+			description: "inner depth higher than outer depth",
+			outer:       []coagent.RunOption{coagent.WithMaxDepth(2)},
+			inner:       []coagent.RunOption{coagent.WithMaxDepth(10)},
+			runs:        2,
+		},
+		{description: "zero depth", outer: []coagent.RunOption{coagent.WithMaxDepth(0)}, runs: 8},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			// The agent runs itself recursively as a tool would.
+			var (
+				runs  int
+				agent coagent.Agent
+			)
+			agent = coagent.Agent{
+				Name: "agent",
+				Runner: coagent.RunnerFunc(func(
+					ctx context.Context, _ coagent.Agent, messages []coagent.Message, _ []coagent.RunOption,
+				) (coagent.Message, error) {
+					runs++
+
+					return agent.Run(ctx, messages, testcase.inner...)
+				}),
+			}
+			_, err := agent.Run(context.Background(), nil, testcase.outer...)
+			assert.Equal(t, true, errors.Is(err, coagent.ErrMaxDepthExceeded))
+			assert.Equal(t, testcase.runs, runs)
+		})
+	}
+}
+
+func TestAgent_Run_fallbackErrors(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		description string
+		err         error
+		models      []string
+	}{
+		{
+			description: "model not found",
+			err:         fmt.Errorf("%w: %w", coagent.ErrModelUnavailable, coagent.ErrNotFound),
+			models:      []string{"m1", "m2"},
+		},
+		{
+			description: "model overloaded",
+			err:         fmt.Errorf("%w: %w", coagent.ErrModelUnavailable, coagent.ErrOverloaded),
+			models:      []string{"m1", "m2"},
+		},
+		{
+			description: "resource not found",
+			err:         coagent.ErrNotFound,
+			models:      []string{"m1"},
+		},
+		{
+			description: "provider overloaded",
+			err:         coagent.ErrOverloaded,
+			models:      []string{"m1"},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			var models []string
+			agent := coagent.Agent{
+				Name:           "agent",
+				Model:          "m1",
+				FallbackModels: []string{"m2"},
+				Runner: coagent.RunnerFunc(func(
+					_ context.Context, agent coagent.Agent, _ []coagent.Message, _ []coagent.RunOption,
+				) (coagent.Message, error) {
+					models = append(models, agent.Model)
+					if agent.Model == "m1" {
+						return coagent.Message{}, testcase.err
+					}
+
+					return coagent.Message{}, nil
+				}),
+			}
+			_, _ = agent.Run(context.Background(), nil)
+			assert.Equal(t, testcase.models, models)
+		})
+	}
+}
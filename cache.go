@@ -0,0 +1,301 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CacheQuery identifies a run whose response could be served from a Cache.
+type CacheQuery struct {
+	// Fingerprint identifies the agent and the options of the run.
+	// Only runs with the same fingerprint could share responses.
+	Fingerprint string
+	// Text is the text of the messages of the run.
+	Text string
+}
+
+// Cache is the interface that stores the responses of runs for RunCache.
+type Cache interface {
+	// Lookup returns the response for the query, and whether it's found.
+	Lookup(ctx context.Context, query CacheQuery) (Message, bool, error)
+	// Store stores the response for the query.
+	Store(ctx context.Context, query CacheQuery, response Message) error
+}
+
+// RunCache returns a RunnerMiddleware which serves the response from the cache
+// if the agent has run the same messages before, without calling the model.
+// It's useful for deployments which answer repeated questions, e.g. FAQ.
+//
+// Runs with content other than Text, or with options not defined by this package, are not cached.
+// The timeout, max depth, priority and metadata of runs don't affect the response,
+// so runs differing only in them share the response.
+//
+// The middleware should be chained after the middlewares changing the agent or messages, e.g. AuthorizeTools,
+// so the response is cached for the effective run.
+func RunCache(cache Cache) RunnerMiddleware {
+	return func(runner Runner) Runner {
+		return RunnerFunc(func(ctx context.Context, agent Agent, messages []Message, opts []RunOption) (Message, error) {
+			query, ok := newCacheQuery(agent, messages, opts)
+			if !ok {
+				return runner.Run(ctx, agent, messages, opts)
+			}
+
+			response, found, err := cache.Lookup(ctx, query)
+			if err != nil {
+				return Message{}, fmt.Errorf("lookup cache: %w", err)
+			}
+			if found {
+				return response, nil
+			}
+
+			response, err = runner.Run(ctx, agent, messages, opts)
+			if err != nil {
+				return Message{}, err
+			}
+			if err = cache.Store(ctx, query, response); err != nil {
+				return Message{}, fmt.Errorf("store cache: %w", err)
+			}
+
+			return response, nil
+		})
+	}
+}
+
+func newCacheQuery(agent Agent, messages []Message, opts []RunOption) (CacheQuery, bool) {
+	config, err := NewRunConfig(opts)
+	// Options not defined by this package could not be fingerprinted.
+	if err != nil || len(config.Others) > 0 {
+		return CacheQuery{}, false
+	}
+
+	// Each message and part is quoted so their boundaries are unambiguous.
+	var (
+		text         strings.Builder
+		messageTools [][]Tool
+	)
+	for _, message := range messages {
+		messageTools = append(messageTools, message.Tools)
+		_, _ = fmt.Fprintf(&text, "%q %d\n", message.Role, len(message.Content))
+		for _, content := range message.Content {
+			textContent, ok := content.(Text)
+			if !ok {
+				return CacheQuery{}, false
+			}
+			_, _ = fmt.Fprintf(&text, "%q\n", textContent.Text)
+		}
+	}
+
+	// Fingerprint the agent, the tools of messages and the effective config of the run,
+	// except the fields which don't affect the response.
+	var seed string
+	if config.Seed != nil {
+		seed = strconv.FormatInt(*config.Seed, 10)
+	}
+	fingerprint := struct {
+		Name, Model, Instructions string
+		Tools                     []Tool
+		MessageTools              [][]Tool
+		JSONMode                  bool
+		StopSequences             []string
+		Seed, Locale, User        string
+		MaxTokens                 int
+		ExtraBody                 map[string]any
+		Overrides                 Overrides
+	}{
+		Name: agent.Name, Model: agent.Model, Instructions: agent.Instructions,
+		Tools: agent.Tools, MessageTools: messageTools,
+		JSONMode: config.JSONMode, StopSequences: config.StopSequences,
+		Seed: seed, Locale: config.Locale, User: config.User,
+		MaxTokens: config.MaxTokens, ExtraBody: config.ExtraBody, Overrides: config.Overrides,
+	}
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%#v", fingerprint)
+
+	return CacheQuery{Fingerprint: hex.EncodeToString(hash.Sum(nil)), Text: text.String()}, true
+}
+
+// MemoryCache is a Cache in memory which matches queries exactly.
+// Its zero value is ready to use.
+type MemoryCache struct {
+	// MaxEntries is the maximum number of cached responses, beyond which the oldest ones are evicted.
+	// Zero means no limit, so the cache grows with each distinct query.
+	MaxEntries int
+
+	mu        sync.RWMutex
+	responses map[CacheQuery]Message
+	order     []CacheQuery
+}
+
+func (m *MemoryCache) Lookup(_ context.Context, query CacheQuery) (Message, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	response, ok := m.responses[query]
+
+	return cloneResponse(response), ok, nil
+}
+
+func (m *MemoryCache) Store(_ context.Context, query CacheQuery, response Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.responses == nil {
+		m.responses = make(map[CacheQuery]Message)
+	}
+	if _, exists := m.responses[query]; !exists {
+		if m.MaxEntries > 0 && len(m.order) >= m.MaxEntries {
+			delete(m.responses, m.order[0])
+			m.order = m.order[1:]
+		}
+		m.order = append(m.order, query)
+	}
+	m.responses[query] = cloneResponse(response)
+
+	return nil
+}
+
+// SemanticCache is a Cache in memory which matches queries by the similarity of their embeddings,
+// so questions with different wording but the same meaning could share the response.
+type SemanticCache struct {
+	// Embed returns the embedding of the text, e.g. from an embedding model.
+	Embed func(ctx context.Context, text string) ([]float64, error)
+	// Threshold is the minimal cosine similarity for queries to match.
+	// Zero or negative means the default threshold of 0.95, since it would match unrelated queries.
+	Threshold float64
+	// MaxEntries is the maximum number of cached responses, beyond which the oldest ones are evicted.
+	// Zero means no limit, so the cache grows with each stored response.
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string][]semanticEntry
+	// order are the fingerprints of the entries in the order they are stored.
+	order []string
+	// pending are the embeddings of missed queries, which are reused when their responses are stored.
+	pending map[CacheQuery][]float64
+}
+
+const (
+	defaultSemanticThreshold = 0.95
+	maxPendingEmbeddings     = 1024
+)
+
+type semanticEntry struct {
+	embedding []float64
+	response  Message
+}
+
+func (s *SemanticCache) Lookup(ctx context.Context, query CacheQuery) (Message, bool, error) {
+	embedding, err := s.Embed(ctx, query.Text)
+	if err != nil {
+		return Message{}, false, fmt.Errorf("embed query: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		best       Message
+		found      bool
+		similarity = s.Threshold
+	)
+	if similarity <= 0 {
+		similarity = defaultSemanticThreshold
+	}
+	for _, entry := range s.entries[query.Fingerprint] {
+		if sim := cosineSimilarity(embedding, entry.embedding); sim >= similarity {
+			best, found, similarity = cloneResponse(entry.response), true, sim
+		}
+	}
+
+	if !found {
+		if s.pending == nil {
+			s.pending = make(map[CacheQuery][]float64)
+		}
+		// Runs could fail without storing responses, so drop an arbitrary embedding to bound the memory.
+		if len(s.pending) >= maxPendingEmbeddings {
+			for pending := range s.pending {
+				delete(s.pending, pending)
+
+				break
+			}
+		}
+		s.pending[query] = embedding
+	}
+
+	return best, found, nil
+}
+
+func (s *SemanticCache) Store(ctx context.Context, query CacheQuery, response Message) error {
+	s.mu.Lock()
+	embedding, ok := s.pending[query]
+	delete(s.pending, query)
+	s.mu.Unlock()
+
+	if !ok {
+		var err error
+		if embedding, err = s.Embed(ctx, query.Text); err != nil {
+			return fmt.Errorf("embed query: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.entries == nil {
+		s.entries = make(map[string][]semanticEntry)
+	}
+	if s.MaxEntries > 0 && len(s.order) >= s.MaxEntries {
+		// Entries of each fingerprint are in the order they are stored, so the first one is the oldest.
+		oldest := s.order[0]
+		s.order = s.order[1:]
+		if s.entries[oldest] = s.entries[oldest][1:]; len(s.entries[oldest]) == 0 {
+			delete(s.entries, oldest)
+		}
+	}
+	s.order = append(s.order, query.Fingerprint)
+	s.entries[query.Fingerprint] = append(s.entries[query.Fingerprint], semanticEntry{
+		embedding: embedding,
+		response:  cloneResponse(response),
+	})
+
+	return nil
+}
+
+// cloneResponse returns a copy of the response which does not share the content and metadata,
+// so callers modifying responses never change the cached ones.
+func cloneResponse(response Message) Message {
+	response.Content = slices.Clone(response.Content)
+	response.Tools = slices.Clone(response.Tools)
+	response.Metadata = maps.Clone(response.Metadata)
+
+	return response
+}
+
+func cosineSimilarity(x, y []float64) float64 {
+	if len(x) != len(y) {
+		return 0
+	}
+
+	var dot, normX, normY float64
+	for i := range x {
+		dot += x[i] * y[i]
+		normX += x[i] * x[i]
+		normY += y[i] * y[i]
+	}
+	if normX == 0 || normY == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normX) * math.Sqrt(normY))
+}
@@ -0,0 +1,274 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ktong/coagent"
+	"github.com/ktong/coagent/internal/assert"
+	"github.com/ktong/coagent/internal/embedded"
+)
+
+func TestRunCache(t *testing.T) {
+	t.Parallel()
+
+	text := func(role, text string) coagent.Message {
+		return coagent.Message{Role: role, Content: []coagent.Content{coagent.Text{Text: text}}}
+	}
+	question := []coagent.Message{text(coagent.RoleUser, "hi")}
+
+	testcases := []struct {
+		description string
+		messages    []coagent.Message
+		opts        []coagent.RunOption
+		runs        int
+	}{
+		{
+			description: "same run",
+			messages:    question,
+			runs:        1,
+		},
+		{
+			description: "run with options not affecting response",
+			messages:    question,
+			opts:        []coagent.RunOption{coagent.WithPriority(1), coagent.WithMetadata(map[string]string{"key": "value"})},
+			runs:        1,
+		},
+		{
+			description: "different messages",
+			messages:    []coagent.Message{text(coagent.RoleUser, "hello")},
+			runs:        2,
+		},
+		{
+			description: "message boundaries",
+			messages:    []coagent.Message{text(coagent.RoleUser, "hi\nassistant: yo")},
+			runs:        2,
+		},
+		{
+			description: "overrides",
+			messages:    question,
+			opts:        []coagent.RunOption{coagent.WithOverrides(coagent.Overrides{Model: "other"})},
+			runs:        2,
+		},
+		{
+			description: "max tokens",
+			messages:    question,
+			opts:        []coagent.RunOption{coagent.WithMaxTokens(10)},
+			runs:        2,
+		},
+		{
+			description: "user",
+			messages:    question,
+			opts:        []coagent.RunOption{coagent.WithUser("bob")},
+			runs:        2,
+		},
+		{
+			description: "message tools",
+			messages:    []coagent.Message{{Role: coagent.RoleUser, Content: question[0].Content, Tools: []coagent.Tool{namedTool{name: "search"}}}},
+			runs:        2,
+		},
+		{
+			description: "unknown options",
+			messages:    question,
+			opts:        []coagent.RunOption{customOption{}},
+			runs:        3,
+		},
+		{
+			description: "image content",
+			messages:    []coagent.Message{{Role: coagent.RoleUser, Content: []coagent.Content{coagent.Image{}}}},
+			runs:        3,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			var runs int
+			runner := coagent.Chain(
+				coagent.RunnerFunc(func(context.Context, coagent.Agent, []coagent.Message, []coagent.RunOption) (coagent.Message, error) {
+					runs++
+
+					return text(coagent.RoleAssistant, "yo"), nil
+				}),
+				coagent.RunCache(&coagent.MemoryCache{}),
+			)
+			agent := coagent.Agent{Name: "agent", Model: "model"}
+
+			// Run the question first, then the test case twice.
+			for _, run := range []struct {
+				messages []coagent.Message
+				opts     []coagent.RunOption
+			}{
+				{messages: question},
+				{messages: testcase.messages, opts: testcase.opts},
+				{messages: testcase.messages, opts: testcase.opts},
+			} {
+				response, err := runner.Run(context.Background(), agent, run.messages, run.opts)
+				assert.NoError(t, err)
+				assert.Equal(t, text(coagent.RoleAssistant, "yo"), response)
+			}
+			assert.Equal(t, testcase.runs, runs)
+		})
+	}
+}
+
+type customOption struct {
+	embedded.RunOption
+}
+
+func TestSemanticCache(t *testing.T) {
+	t.Parallel()
+
+	embeddings := map[string][]float64{
+		"hi":    {1, 0},
+		"hello": {0.99, 0.1},
+		"bye":   {0.2, 1},
+	}
+
+	testcases := []struct {
+		description string
+		threshold   float64
+		query       string
+		found       bool
+	}{
+		{description: "same text", query: "hi", found: true},
+		{description: "similar text", query: "hello", found: true},
+		{description: "unrelated text with default threshold", query: "bye"},
+		{description: "negative threshold", threshold: -1, query: "bye"},
+		{description: "low threshold", threshold: 0.1, query: "bye", found: true},
+		{description: "high threshold", threshold: 0.999, query: "hello"},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			var embeds int
+			cache := &coagent.SemanticCache{
+				Embed: func(_ context.Context, text string) ([]float64, error) {
+					embeds++
+
+					return embeddings[text], nil
+				},
+				Threshold: testcase.threshold,
+			}
+			ctx := context.Background()
+			response := coagent.Message{Role: coagent.RoleAssistant, Content: []coagent.Content{coagent.Text{Text: "yo"}}}
+
+			// The embedding of the missed query is reused when storing its response.
+			query := coagent.CacheQuery{Fingerprint: "agent", Text: "hi"}
+			_, found, err := cache.Lookup(ctx, query)
+			assert.NoError(t, err)
+			assert.Equal(t, false, found)
+			assert.NoError(t, cache.Store(ctx, query, response))
+			assert.Equal(t, 1, embeds)
+
+			actual, found, err := cache.Lookup(ctx, coagent.CacheQuery{Fingerprint: "agent", Text: testcase.query})
+			assert.NoError(t, err)
+			assert.Equal(t, testcase.found, found)
+			if testcase.found {
+				assert.Equal(t, response, actual)
+			}
+		})
+	}
+}
+
+func TestCache_isolation(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		description string
+		cache       coagent.Cache
+	}{
+		{description: "memory cache", cache: &coagent.MemoryCache{}},
+		{
+			description: "semantic cache",
+			cache: &coagent.SemanticCache{Embed: func(context.Context, string) ([]float64, error) {
+				return []float64{1, 0}, nil
+			}},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			query := coagent.CacheQuery{Fingerprint: "agent", Text: "hi"}
+			response := coagent.Message{
+				Role:     coagent.RoleAssistant,
+				Content:  []coagent.Content{coagent.Text{Text: "yo"}},
+				Metadata: map[string]string{"key": "value"},
+			}
+			expected := coagent.Message{
+				Role:     coagent.RoleAssistant,
+				Content:  []coagent.Content{coagent.Text{Text: "yo"}},
+				Metadata: map[string]string{"key": "value"},
+			}
+
+			// Modifying the stored or returned responses must not change the cached one.
+			assert.NoError(t, testcase.cache.Store(ctx, query, response))
+			response.Content[0] = coagent.Text{Text: "mutated"}
+			response.Metadata["key"] = "mutated"
+			cached, found, err := testcase.cache.Lookup(ctx, query)
+			assert.NoError(t, err)
+			assert.Equal(t, true, found)
+			assert.Equal(t, expected, cached)
+
+			cached.Content[0] = coagent.Text{Text: "mutated"}
+			cached.Metadata["key"] = "mutated"
+			cached, _, err = testcase.cache.Lookup(ctx, query)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, cached)
+		})
+	}
+}
+
+func TestCache_maxEntries(t *testing.T) {
+	t.Parallel()
+
+	embeddings := map[string][]float64{"a": {1, 0, 0}, "b": {0, 1, 0}, "c": {0, 0, 1}}
+
+	testcases := []struct {
+		description string
+		cache       coagent.Cache
+	}{
+		{description: "memory cache", cache: &coagent.MemoryCache{MaxEntries: 2}},
+		{
+			description: "semantic cache",
+			cache: &coagent.SemanticCache{
+				Embed: func(_ context.Context, text string) ([]float64, error) {
+					return embeddings[text], nil
+				},
+				MaxEntries: 2,
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			for _, text := range []string{"a", "b", "b", "c"} {
+				response := coagent.Message{Content: []coagent.Content{coagent.Text{Text: text}}}
+				assert.NoError(t, testcase.cache.Store(ctx, coagent.CacheQuery{Fingerprint: "agent", Text: text}, response))
+			}
+
+			// The oldest entry is evicted.
+			var found []string
+			for _, text := range []string{"a", "b", "c"} {
+				_, ok, err := testcase.cache.Lookup(ctx, coagent.CacheQuery{Fingerprint: "agent", Text: text})
+				assert.NoError(t, err)
+				if ok {
+					found = append(found, text)
+				}
+			}
+			assert.Equal(t, []string{"b", "c"}, found)
+		})
+	}
+}
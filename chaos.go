@@ -0,0 +1,76 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// FaultInjector injects faults of providers into runs, so applications could test their resilience,
+// e.g. retries and fallbacks, against realistic failures. The faults are decided by a random source
+// seeded with Seed, so the same sequence of runs fails the same way.
+//
+// Rates are probabilities between 0 and 1. Its zero value does not inject any fault.
+// It must not be copied after first use.
+type FaultInjector struct {
+	Seed uint64
+
+	// RateLimitRate is the rate of runs failing with ErrRateLimited.
+	RateLimitRate float64
+	// OverloadRate is the rate of runs failing with ErrOverloaded.
+	OverloadRate float64
+	// TimeoutRate is the rate of runs hanging until the context is done.
+	TimeoutRate float64
+	// SlowRate is the rate of runs delayed by Latency before running.
+	SlowRate float64
+	Latency  time.Duration
+
+	once sync.Once
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// Middleware returns a RunnerMiddleware which injects the faults into runs.
+func (f *FaultInjector) Middleware() RunnerMiddleware {
+	return func(runner Runner) Runner {
+		return RunnerFunc(func(ctx context.Context, agent Agent, messages []Message, opts []RunOption) (Message, error) {
+			switch fault := f.next(); {
+			case fault < f.RateLimitRate:
+				return Message{}, fmt.Errorf("injected fault: %w", ErrRateLimited)
+			case fault < f.RateLimitRate+f.OverloadRate:
+				return Message{}, fmt.Errorf("injected fault: %w", ErrOverloaded)
+			case fault < f.RateLimitRate+f.OverloadRate+f.TimeoutRate:
+				<-ctx.Done()
+
+				return Message{}, fmt.Errorf("injected fault: %w", ctx.Err())
+			case fault < f.RateLimitRate+f.OverloadRate+f.TimeoutRate+f.SlowRate:
+				timer := time.NewTimer(f.Latency)
+				defer timer.Stop()
+
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					return Message{}, fmt.Errorf("injected fault: %w", ctx.Err())
+				}
+			}
+
+			return runner.Run(ctx, agent, messages, opts)
+		})
+	}
+}
+
+func (f *FaultInjector) next() float64 {
+	f.once.Do(func() {
+		f.rand = rand.New(rand.NewPCG(f.Seed, f.Seed)) //nolint:gosec
+	})
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.rand.Float64()
+}
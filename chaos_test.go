@@ -0,0 +1,132 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ktong/coagent"
+	"github.com/ktong/coagent/internal/assert"
+)
+
+func TestFaultInjector(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		description string
+		injector    *coagent.FaultInjector
+		timeout     time.Duration
+		err         error
+		ran         bool
+		latency     time.Duration
+	}{
+		{
+			description: "no fault",
+			injector:    &coagent.FaultInjector{},
+			ran:         true,
+		},
+		{
+			description: "rate limit",
+			injector:    &coagent.FaultInjector{RateLimitRate: 1},
+			err:         coagent.ErrRateLimited,
+		},
+		{
+			description: "overload",
+			injector:    &coagent.FaultInjector{OverloadRate: 1},
+			err:         coagent.ErrOverloaded,
+		},
+		{
+			description: "timeout",
+			injector:    &coagent.FaultInjector{TimeoutRate: 1},
+			timeout:     10 * time.Millisecond,
+			err:         context.DeadlineExceeded,
+		},
+		{
+			description: "latency",
+			injector:    &coagent.FaultInjector{SlowRate: 1, Latency: 20 * time.Millisecond},
+			ran:         true,
+			latency:     20 * time.Millisecond,
+		},
+		{
+			description: "latency exceeding timeout",
+			injector:    &coagent.FaultInjector{SlowRate: 1, Latency: time.Hour},
+			timeout:     10 * time.Millisecond,
+			err:         context.DeadlineExceeded,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			var ran bool
+			runner := coagent.Chain(
+				coagent.RunnerFunc(func(context.Context, coagent.Agent, []coagent.Message, []coagent.RunOption) (coagent.Message, error) {
+					ran = true
+
+					return coagent.Message{}, nil
+				}),
+				testcase.injector.Middleware(),
+			)
+
+			ctx := context.Background()
+			if testcase.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, testcase.timeout)
+				defer cancel()
+			}
+			start := time.Now()
+			_, err := runner.Run(ctx, coagent.Agent{}, nil, nil)
+			if testcase.err != nil {
+				assert.Equal(t, true, errors.Is(err, testcase.err))
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, testcase.ran, ran)
+			assert.Equal(t, true, time.Since(start) >= testcase.latency)
+		})
+	}
+}
+
+func TestFaultInjector_seed(t *testing.T) {
+	t.Parallel()
+
+	faults := func(seed uint64) []string {
+		injector := &coagent.FaultInjector{Seed: seed, RateLimitRate: 0.3, OverloadRate: 0.3}
+		runner := coagent.Chain(
+			coagent.RunnerFunc(func(context.Context, coagent.Agent, []coagent.Message, []coagent.RunOption) (coagent.Message, error) {
+				return coagent.Message{}, nil
+			}),
+			injector.Middleware(),
+		)
+
+		var faults []string
+		for range 50 {
+			_, err := runner.Run(context.Background(), coagent.Agent{}, nil, nil)
+			switch {
+			case errors.Is(err, coagent.ErrRateLimited):
+				faults = append(faults, "rate limited")
+			case errors.Is(err, coagent.ErrOverloaded):
+				faults = append(faults, "overloaded")
+			default:
+				assert.NoError(t, err)
+				faults = append(faults, "none")
+			}
+		}
+
+		return faults
+	}
+
+	// The same seed injects the same sequence of faults, which has all kinds of faults.
+	sequence := faults(42)
+	assert.Equal(t, sequence, faults(42))
+	for _, fault := range []string{"rate limited", "overloaded", "none"} {
+		assert.Equal(t, true, slices.Contains(sequence, fault))
+	}
+	assert.Equal(t, false, slices.Equal(sequence, faults(7)))
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+)
+
+// Keys of the metadata stamped on runs by Agent.Run.
+const (
+	MetadataCorrelationID = "correlation_id"
+	MetadataVersion       = "coagent_version"
+)
+
+// WithCorrelationID returns a copy of the context carrying the correlation ID, e.g. the request ID of the application.
+// Agent.Run stamps it on the metadata of runs along with the version of this package,
+// so they could be traced back to the application. Runs without a correlation ID are not stamped,
+// so runners without metadata support are not passed WithMetadata unless it's opted in.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationID returns the correlation ID carried by the context, or empty if there is none.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+
+	return id
+}
+
+type correlationIDKey struct{}
+
+// runMetadata returns the metadata stamped on runs by Agent.Run, or nil if the context carries no correlation ID.
+func runMetadata(ctx context.Context) map[string]string {
+	id := CorrelationID(ctx)
+	if id == "" {
+		return nil
+	}
+
+	return map[string]string{MetadataCorrelationID: id, MetadataVersion: version()}
+}
+
+// version returns the version of this module in the build, or (devel) if it's unknown.
+//
+//nolint:gochecknoglobals
+var version = sync.OnceValue(func() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == "github.com/ktong/coagent" {
+				return dep.Version
+			}
+		}
+	}
+
+	return "(devel)"
+})
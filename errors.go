@@ -0,0 +1,66 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent
+
+import "errors"
+
+var (
+	// ErrInvalidOption is returned when a RunOption has an invalid value.
+	ErrInvalidOption = errors.New("invalid run option")
+	// ErrUnsupportedOption is returned by Runner implementations for a RunOption they do not support.
+	ErrUnsupportedOption = errors.New("unsupported run option")
+
+	// ErrRunTimeout is returned by Agent.Run when the run exceeds the timeout set by WithRunTimeout.
+	ErrRunTimeout = errors.New("run timeout")
+	// ErrMaxDepthExceeded is returned by Agent.Run when the nesting depth of agents running other agents
+	// exceeds the depth set by WithMaxDepth.
+	ErrMaxDepthExceeded = errors.New("max depth exceeded")
+
+	// ErrModelUnavailable is returned by Runner implementations if the model is not found
+	// or out of capacity, so Agent.Run could fall back to the next model in Agent.FallbackModels.
+	// It's wrapped along with the error of the provider, e.g. ErrNotFound or ErrOverloaded
+	// (see the errors of providers below).
+	ErrModelUnavailable = errors.New("model unavailable")
+
+	// ErrInvalidMessage is returned if messages exceed the limits validated by MessageLimits.
+	ErrInvalidMessage = errors.New("invalid message")
+	// ErrNoAcceptedResponse is returned by RaceRun if none of the responses is accepted.
+	ErrNoAcceptedResponse = errors.New("no accepted response")
+	// ErrImageTooLarge is returned by PrepareImage if the image could not fit within the size limit.
+	ErrImageTooLarge = errors.New("image too large")
+
+	// ErrTranscriptExhausted is returned by ReplayRunner when all recorded turns have been replayed.
+	ErrTranscriptExhausted = errors.New("transcript exhausted")
+	// ErrTranscriptMismatch is returned by ReplayRunner when the messages of a run
+	// differ from the recorded messages of the turn.
+	ErrTranscriptMismatch = errors.New("transcript mismatch")
+)
+
+// Errors of providers, which Runner implementations should wrap the provider-specific errors with,
+// so the error handling of applications, e.g. retries, is provider-agnostic.
+//
+// Agent.Run only falls back to the next model on ErrModelUnavailable, since these errors are not specific
+// to the model, e.g. ErrNotFound for a missing thread. If the error is specific to the model,
+// e.g. model_not_found or the model being out of capacity, Runner implementations must also wrap
+// ErrModelUnavailable, e.g. fmt.Errorf("%w: %w", ErrModelUnavailable, ErrNotFound).
+var (
+	// ErrRateLimited is returned if the request exceeds the rate limits or quota of the provider.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrAuth is returned if the credentials are invalid or lack the permission.
+	ErrAuth = errors.New("authentication failed")
+	// ErrNotFound is returned if the resource is not found on the provider side.
+	ErrNotFound = errors.New("not found")
+	// ErrContextLength is returned if the messages exceed the context window of the model.
+	ErrContextLength = errors.New("context length exceeded")
+	// ErrContentFiltered is returned if the input or output is blocked by the content filter of the provider.
+	ErrContentFiltered = errors.New("content filtered")
+	// ErrOverloaded is returned if the provider is temporarily overloaded or has internal errors.
+	ErrOverloaded = errors.New("overloaded")
+)
+
+// IsRetryable reports whether the error is transient so the run could be retried later,
+// i.e. it wraps ErrRateLimited or ErrOverloaded.
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrOverloaded)
+}
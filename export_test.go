@@ -0,0 +1,12 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent
+
+// QueuedRuns returns the number of runs waiting for a slot, so tests could wait until runs are queued.
+func (s *RunScheduler) QueuedRuns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.waiters)
+}
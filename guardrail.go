@@ -0,0 +1,84 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf8"
+)
+
+// MessageLimits are the limits of messages accepted by the provider. Zero fields mean no limit.
+type MessageLimits struct {
+	// MaxMessages is the maximum number of messages in a run.
+	MaxMessages int
+	// MaxTextLength is the maximum number of characters of text in a message,
+	// including the arguments of tool calls and the output of tool results.
+	MaxTextLength int
+	// MaxContents is the maximum number of content parts in a message.
+	MaxContents int
+	// MaxImages is the maximum number of images in a message.
+	MaxImages int
+	// MaxTools is the maximum number of tools attached to a message.
+	MaxTools int
+}
+
+// Validate verifies the messages are within the limits and images have supported detail,
+// and returns an error wrapping ErrInvalidMessage which describes the first violation.
+func (l MessageLimits) Validate(messages []Message) error {
+	if l.MaxMessages > 0 && len(messages) > l.MaxMessages {
+		return fmt.Errorf("%w: %d messages exceeds the limit of %d", ErrInvalidMessage, len(messages), l.MaxMessages)
+	}
+
+	for i, message := range messages {
+		var length, images int
+		for _, content := range message.Content {
+			switch content := content.(type) {
+			case Text:
+				length += utf8.RuneCountInString(content.Text)
+			case ToolCall:
+				length += utf8.RuneCountInString(content.Arguments)
+			case ToolResult:
+				length += utf8.RuneCountInString(content.Output)
+			case Image:
+				if !content.Detail.Valid() {
+					return fmt.Errorf("%w: message %d has an image with unsupported detail %q",
+						ErrInvalidMessage, i, content.Detail)
+				}
+				images++
+			}
+		}
+
+		switch {
+		case l.MaxTextLength > 0 && length > l.MaxTextLength:
+			return fmt.Errorf("%w: message %d has %d characters of text which exceeds the limit of %d",
+				ErrInvalidMessage, i, length, l.MaxTextLength)
+		case l.MaxContents > 0 && len(message.Content) > l.MaxContents:
+			return fmt.Errorf("%w: message %d has %d content parts which exceeds the limit of %d",
+				ErrInvalidMessage, i, len(message.Content), l.MaxContents)
+		case l.MaxImages > 0 && images > l.MaxImages:
+			return fmt.Errorf("%w: message %d has %d images which exceeds the limit of %d",
+				ErrInvalidMessage, i, images, l.MaxImages)
+		case l.MaxTools > 0 && len(message.Tools) > l.MaxTools:
+			return fmt.Errorf("%w: message %d has %d tools attached which exceeds the limit of %d",
+				ErrInvalidMessage, i, len(message.Tools), l.MaxTools)
+		}
+	}
+
+	return nil
+}
+
+// Guardrail returns a RunnerMiddleware which validates the messages by MessageLimits.Validate before running,
+// so violations are reported with descriptive errors instead of generic errors from the provider.
+func Guardrail(limits MessageLimits) RunnerMiddleware {
+	return func(runner Runner) Runner {
+		return RunnerFunc(func(ctx context.Context, agent Agent, messages []Message, opts []RunOption) (Message, error) {
+			if err := limits.Validate(messages); err != nil {
+				return Message{}, err
+			}
+
+			return runner.Run(ctx, agent, messages, opts)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ktong/coagent"
+	"github.com/ktong/coagent/internal/assert"
+)
+
+func TestMessageLimits_Validate(t *testing.T) {
+	t.Parallel()
+
+	message := func(contents ...coagent.Content) coagent.Message {
+		return coagent.Message{Role: coagent.RoleUser, Content: contents}
+	}
+
+	testcases := []struct {
+		description string
+		limits      coagent.MessageLimits
+		messages    []coagent.Message
+		err         string
+	}{
+		{
+			description: "no limits",
+			messages:    []coagent.Message{message(coagent.Text{Text: "hello"}, coagent.Image{})},
+		},
+		{
+			description: "within limits",
+			limits:      coagent.MessageLimits{MaxMessages: 1, MaxTextLength: 5, MaxContents: 2, MaxImages: 1, MaxTools: 1},
+			messages: []coagent.Message{{
+				Role:    coagent.RoleUser,
+				Content: []coagent.Content{coagent.Text{Text: "héllo"}, coagent.Image{Detail: coagent.DetailLow}},
+				Tools:   []coagent.Tool{namedTool{name: "search"}},
+			}},
+		},
+		{
+			description: "max messages",
+			limits:      coagent.MessageLimits{MaxMessages: 1},
+			messages:    []coagent.Message{message(), message()},
+			err:         "invalid message: 2 messages exceeds the limit of 1",
+		},
+		{
+			description: "max text length",
+			limits:      coagent.MessageLimits{MaxTextLength: 4},
+			messages:    []coagent.Message{message(coagent.Text{Text: "hel"}, coagent.Text{Text: "lo"})},
+			err:         "invalid message: message 0 has 5 characters of text which exceeds the limit of 4",
+		},
+		{
+			description: "max text length with tool call and result",
+			limits:      coagent.MessageLimits{MaxTextLength: 10},
+			messages: []coagent.Message{message(
+				coagent.ToolCall{Name: "search", Arguments: `{"q":"go"}`},
+				coagent.ToolResult{Output: "found"},
+			)},
+			err: "invalid message: message 0 has 15 characters of text which exceeds the limit of 10",
+		},
+		{
+			description: "max contents",
+			limits:      coagent.MessageLimits{MaxContents: 1},
+			messages:    []coagent.Message{message(), message(coagent.Text{}, coagent.Text{})},
+			err:         "invalid message: message 1 has 2 content parts which exceeds the limit of 1",
+		},
+		{
+			description: "max images",
+			limits:      coagent.MessageLimits{MaxImages: 1},
+			messages:    []coagent.Message{message(coagent.Image{}, coagent.Text{}, coagent.Image{})},
+			err:         "invalid message: message 0 has 2 images which exceeds the limit of 1",
+		},
+		{
+			description: "max tools",
+			limits:      coagent.MessageLimits{MaxTools: 1},
+			messages: []coagent.Message{{
+				Role:  coagent.RoleUser,
+				Tools: []coagent.Tool{namedTool{name: "search"}, namedTool{name: "delete"}},
+			}},
+			err: "invalid message: message 0 has 2 tools attached which exceeds the limit of 1",
+		},
+		{
+			description: "unsupported image detail",
+			messages:    []coagent.Message{message(coagent.Image{Detail: "ultra"})},
+			err:         `invalid message: message 0 has an image with unsupported detail "ultra"`,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			err := testcase.limits.Validate(testcase.messages)
+			if testcase.err != "" {
+				assert.EqualError(t, err, testcase.err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			// Guardrail rejects the same messages without running.
+			var ran bool
+			runner := coagent.Chain(
+				coagent.RunnerFunc(func(context.Context, coagent.Agent, []coagent.Message, []coagent.RunOption) (coagent.Message, error) {
+					ran = true
+
+					return coagent.Message{}, nil
+				}),
+				coagent.Guardrail(testcase.limits),
+			)
+			_, err = runner.Run(context.Background(), coagent.Agent{}, testcase.messages, nil)
+			if testcase.err != "" {
+				assert.EqualError(t, err, testcase.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, testcase.err == "", ran)
+		})
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // Register GIF decoder.
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"slices"
+)
+
+// ImageDetail is the level of detail the model uses to understand an image.
+type ImageDetail string
+
+const (
+	// DetailAuto lets the model decide the level of detail by the size of the image.
+	DetailAuto ImageDetail = "auto"
+	// DetailLow uses a low-resolution version of the image, which costs fewer tokens and responds faster.
+	DetailLow ImageDetail = "low"
+	// DetailHigh uses the image in detailed crops after the low-resolution version.
+	DetailHigh ImageDetail = "high"
+)
+
+// Valid reports whether the detail is one of DetailAuto, DetailLow, DetailHigh or empty.
+// Agent.Run rejects images with invalid detail, and Runner implementations called directly
+// should validate the messages by MessageLimits.Validate, which also rejects them.
+func (d ImageDetail) Valid() bool {
+	switch d {
+	case "", DetailAuto, DetailLow, DetailHigh:
+		return true
+	default:
+		return false
+	}
+}
+
+// EstimateImageTokens estimates the number of input tokens an image with the dimensions costs
+// at the level of detail, following the calculation of OpenAI vision models.
+// DetailAuto is estimated as DetailHigh, which is the upper bound.
+func EstimateImageTokens(width, height int, detail ImageDetail) int {
+	const (
+		baseTokens = 85
+		tileTokens = 170
+		tileSize   = 512
+		maxSide    = 2048
+		shortSide  = 768
+	)
+
+	if detail == DetailLow || width <= 0 || height <= 0 {
+		return baseTokens
+	}
+
+	// Fit within maxSide x maxSide, then scale the shorter side down to shortSide.
+	scale := min(1, float64(maxSide)/float64(max(width, height)), float64(shortSide)/float64(min(width, height)))
+	tilesX := int(math.Ceil(float64(width) * scale / tileSize))
+	tilesY := int(math.Ceil(float64(height) * scale / tileSize))
+
+	return baseTokens + tileTokens*tilesX*tilesY
+}
+
+// ImageLimits are the limits of images accepted by the provider.
+type ImageLimits struct {
+	// MaxDimension is the maximum length in pixels of the longer side. Zero means 2048.
+	MaxDimension int
+	// MaxBytes is the maximum size in bytes of the encoded image. Zero means 20 MB.
+	MaxBytes int
+}
+
+// PrepareImage makes the image fit within the limits. Images already within the limits are passed through as is,
+// including images in formats which could not be decoded (e.g. WebP) as long as they are within the size limit.
+// Otherwise, the image is downscaled and converted to PNG,
+// or JPEG if the original image is JPEG or the PNG exceeds the size limit.
+// It also sets the detail to low for small images if the detail is not specified,
+// since they don't benefit from high detail.
+//
+// It returns an error wrapping ErrImageTooLarge if the image could not fit within the size limit.
+func PrepareImage(img Image, limits ImageLimits) (Image, error) {
+	maxDimension := cmp.Or(limits.MaxDimension, defaultMaxImageDimension)
+	maxBytes := cmp.Or(limits.MaxBytes, defaultMaxImageBytes)
+
+	data, err := io.ReadAll(img.Image)
+	if err != nil {
+		return Image{}, fmt.Errorf("read image: %w", err)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	switch {
+	case errors.Is(err, image.ErrFormat):
+		// Leave it to the provider to accept or reject the format.
+		if len(data) > maxBytes {
+			return Image{}, fmt.Errorf("%d bytes exceeds %d bytes: %w", len(data), maxBytes, ErrImageTooLarge)
+		}
+		img.Image = bytes.NewReader(data)
+
+		return img, nil
+	case err != nil:
+		return Image{}, fmt.Errorf("decode image config: %w", err)
+	}
+	if img.Detail == "" && max(config.Width, config.Height) <= lowDetailDimension {
+		img.Detail = DetailLow
+	}
+	if max(config.Width, config.Height) <= maxDimension && len(data) <= maxBytes {
+		img.Image = bytes.NewReader(data)
+
+		return img, nil
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, fmt.Errorf("decode image: %w", err)
+	}
+	decoded = downscale(decoded, maxDimension)
+
+	var buf bytes.Buffer
+	if format != "jpeg" {
+		if err = png.Encode(&buf, decoded); err != nil {
+			return Image{}, fmt.Errorf("encode png: %w", err)
+		}
+	}
+	for _, quality := range jpegQualities {
+		if buf.Len() > 0 && buf.Len() <= maxBytes {
+			break
+		}
+		buf.Reset()
+		if err = jpeg.Encode(&buf, decoded, &jpeg.Options{Quality: quality}); err != nil {
+			return Image{}, fmt.Errorf("encode jpeg: %w", err)
+		}
+	}
+	if buf.Len() > maxBytes {
+		return Image{}, fmt.Errorf("%d bytes exceeds %d bytes: %w", buf.Len(), maxBytes, ErrImageTooLarge)
+	}
+
+	img.Image = &buf
+	if bounds := decoded.Bounds(); img.Detail == "" && max(bounds.Dx(), bounds.Dy()) <= lowDetailDimension {
+		img.Detail = DetailLow
+	}
+
+	return img, nil
+}
+
+// PrepareImages returns a RunnerMiddleware which applies PrepareImage to all images in the messages,
+// avoiding errors from the provider for oversized images, e.g. screenshots.
+func PrepareImages(limits ImageLimits) RunnerMiddleware {
+	return func(runner Runner) Runner {
+		return RunnerFunc(func(ctx context.Context, agent Agent, messages []Message, opts []RunOption) (Message, error) {
+			messages = slices.Clone(messages)
+			for i, message := range messages {
+				if !slices.ContainsFunc(message.Content, isImage) {
+					continue
+				}
+
+				message.Content = slices.Clone(message.Content)
+				for j, content := range message.Content {
+					if img, ok := content.(Image); ok {
+						prepared, err := PrepareImage(img, limits)
+						if err != nil {
+							return Message{}, err
+						}
+						message.Content[j] = prepared
+					}
+				}
+				messages[i] = message
+			}
+
+			return runner.Run(ctx, agent, messages, opts)
+		})
+	}
+}
+
+// replayableMessages reads the images in the messages once, and returns a function which returns copies
+// of the messages with their own readers of the images, so the messages could be run multiple times or concurrently.
+func replayableMessages(messages []Message) (func() []Message, error) {
+	if !slices.ContainsFunc(messages, func(message Message) bool { return slices.ContainsFunc(message.Content, isImage) }) {
+		return func() []Message { return messages }, nil
+	}
+
+	images := make(map[[2]int][]byte)
+	for i, message := range messages {
+		for j, content := range message.Content {
+			if img, ok := content.(Image); ok && img.Image != nil {
+				data, err := io.ReadAll(img.Image)
+				if err != nil {
+					return nil, fmt.Errorf("read image: %w", err)
+				}
+				images[[2]int{i, j}] = data
+			}
+		}
+	}
+
+	return func() []Message {
+		messages := slices.Clone(messages)
+		for i, message := range messages {
+			if !slices.ContainsFunc(message.Content, isImage) {
+				continue
+			}
+
+			message.Content = slices.Clone(message.Content)
+			for j, content := range message.Content {
+				if data, ok := images[[2]int{i, j}]; ok {
+					img, _ := content.(Image)
+					img.Image = bytes.NewReader(data)
+					message.Content[j] = img
+				}
+			}
+			messages[i] = message
+		}
+
+		return messages
+	}, nil
+}
+
+func isImage(content Content) bool {
+	_, ok := content.(Image)
+
+	return ok
+}
+
+// downscale scales the image down by averaging the source pixels
+// so the longer side is not longer than maxDimension.
+func downscale(src image.Image, maxDimension int) image.Image {
+	bounds := src.Bounds()
+	longer := max(bounds.Dx(), bounds.Dy())
+	if longer <= maxDimension {
+		return src
+	}
+
+	width := max(1, bounds.Dx()*maxDimension/longer)
+	height := max(1, bounds.Dy()*maxDimension/longer)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		minY := bounds.Min.Y + y*bounds.Dy()/height
+		maxY := max(minY+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := range width {
+			minX := bounds.Min.X + x*bounds.Dx()/width
+			maxX := max(minX+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+
+			var red, green, blue, alpha, count uint64
+			for sy := minY; sy < maxY; sy++ {
+				for sx := minX; sx < maxX; sx++ {
+					r, g, b, a := src.At(sx, sy).RGBA()
+					red, green, blue, alpha = red+uint64(r), green+uint64(g), blue+uint64(b), alpha+uint64(a)
+					count++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(red / count), G: uint16(green / count), B: uint16(blue / count), A: uint16(alpha / count), //nolint:gosec
+			})
+		}
+	}
+
+	return dst
+}
+
+const (
+	defaultMaxImageDimension = 2048
+	defaultMaxImageBytes     = 20 << 20
+	lowDetailDimension       = 512
+)
+
+//nolint:gochecknoglobals,mnd
+var jpegQualities = []int{85, 70, 50}
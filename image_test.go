@@ -0,0 +1,139 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/ktong/coagent"
+	"github.com/ktong/coagent/internal/assert"
+)
+
+func TestEstimateImageTokens(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		description   string
+		width, height int
+		detail        coagent.ImageDetail
+		tokens        int
+	}{
+		{description: "low detail", width: 4096, height: 4096, detail: coagent.DetailLow, tokens: 85},
+		{description: "high detail", width: 1024, height: 1024, detail: coagent.DetailHigh, tokens: 765},
+		{description: "auto detail", width: 2048, height: 4096, detail: coagent.DetailAuto, tokens: 1105},
+		{description: "small image", width: 300, height: 200, tokens: 255},
+		{description: "invalid dimensions", tokens: 85},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, testcase.tokens, coagent.EstimateImageTokens(testcase.width, testcase.height, testcase.detail))
+		})
+	}
+}
+
+func TestPrepareImage(t *testing.T) {
+	t.Parallel()
+
+	small := encodePNG(t, 100, 50)
+	large := encodePNG(t, 1000, 500)
+	photo := encodeJPEG(t, 1000, 500)
+	webp := append([]byte("RIFF\x00\x00\x00\x00WEBPVP8 "), make([]byte, 100)...)
+
+	testcases := []struct {
+		description string
+		data        []byte
+		limits      coagent.ImageLimits
+		detail      coagent.ImageDetail
+		width       int // Zero means the image is passed through as is.
+		format      string
+		err         error
+	}{
+		{description: "compliant png", data: large},
+		{description: "compliant jpeg", data: photo},
+		{description: "small image", data: small, detail: coagent.DetailLow},
+		{description: "unknown format", data: webp},
+		{
+			description: "unknown format exceeds size",
+			data:        webp,
+			limits:      coagent.ImageLimits{MaxBytes: 10},
+			err:         coagent.ErrImageTooLarge,
+		},
+		{
+			description: "png exceeds dimension",
+			data:        large,
+			limits:      coagent.ImageLimits{MaxDimension: 800},
+			width:       800,
+			format:      "png",
+		},
+		{
+			description: "jpeg exceeds dimension",
+			data:        photo,
+			limits:      coagent.ImageLimits{MaxDimension: 800},
+			width:       800,
+			format:      "jpeg",
+		},
+		{
+			description: "downscaled to low detail",
+			data:        large,
+			limits:      coagent.ImageLimits{MaxDimension: 500},
+			detail:      coagent.DetailLow,
+			width:       500,
+			format:      "png",
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			prepared, err := coagent.PrepareImage(coagent.Image{Image: bytes.NewReader(testcase.data)}, testcase.limits)
+			if testcase.err != nil {
+				assert.Equal(t, true, errors.Is(err, testcase.err))
+
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, testcase.detail, prepared.Detail)
+
+			data, err := io.ReadAll(prepared.Image)
+			assert.NoError(t, err)
+			if testcase.width == 0 {
+				assert.Equal(t, testcase.data, data)
+
+				return
+			}
+			config, format, err := image.DecodeConfig(bytes.NewReader(data))
+			assert.NoError(t, err)
+			assert.Equal(t, testcase.width, config.Width)
+			assert.Equal(t, testcase.format, format)
+		})
+	}
+}
+
+func encodePNG(tb testing.TB, width, height int) []byte {
+	tb.Helper()
+
+	var buf bytes.Buffer
+	assert.NoError(tb, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))))
+
+	return buf.Bytes()
+}
+
+func encodeJPEG(tb testing.TB, width, height int) []byte {
+	tb.Helper()
+
+	var buf bytes.Buffer
+	assert.NoError(tb, jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)), nil))
+
+	return buf.Bytes()
+}
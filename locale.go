@@ -0,0 +1,135 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// WithLocale sets the locale of the run as a BCP 47 language tag, e.g. fr or pt-BR.
+// Agent.Run appends instructions asking the model to respond in the language of the locale.
+// Use DetectLanguage to detect the language of the user messages if it's unknown.
+//
+// The locale must be a well-formed tag, since it's part of the instructions.
+// Empty means no locale, e.g. if DetectLanguage could not detect the language.
+func WithLocale(locale string) RunOption {
+	return funcOption{name: "WithLocale", fn: func(config *RunConfig) error {
+		if locale != "" && !languageTagRegexp.MatchString(locale) {
+			return fmt.Errorf("%w: malformed language tag %q", ErrInvalidOption, locale)
+		}
+		config.Locale = locale
+
+		return nil
+	}}
+}
+
+// localeInstructions returns the instructions asking the model to respond in the language of the locale.
+func localeInstructions(locale string) string {
+	language, _, _ := strings.Cut(locale, "-")
+	if name, ok := languageNames[strings.ToLower(language)]; ok {
+		return "Always respond in " + name + " (" + locale + "), regardless of the language of the messages."
+	}
+
+	return "Always respond in the language of the locale " + locale + ", regardless of the language of the messages."
+}
+
+// DetectLanguage returns the ISO 639-1 code of the language the text is most likely written in,
+// or empty if it could not be detected.
+//
+// It's a lightweight heuristic based on the Unicode scripts and common words of the text,
+// which is good enough to choose the response language but not for linguistic analysis.
+func DetectLanguage(text string) string {
+	scripts := make(map[string]int)
+	for _, r := range text {
+		for _, script := range languageScripts {
+			if unicode.Is(script.table, r) {
+				scripts[script.language]++
+
+				break
+			}
+		}
+	}
+
+	var (
+		language string
+		count    int
+	)
+	for _, script := range languageScripts {
+		if scripts[script.language] > count {
+			language, count = script.language, scripts[script.language]
+		}
+	}
+	switch {
+	case language == "zh" && scripts["ja"] > 0:
+		// Japanese uses Han characters along with kana.
+		return "ja"
+	case language != "latin":
+		return language
+	}
+
+	scores := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		for _, language := range commonWords[word] {
+			scores[language]++
+		}
+	}
+	language, count = "", 0
+	for _, candidate := range latinLanguages {
+		if scores[candidate] > count {
+			language, count = candidate, scores[candidate]
+		}
+	}
+
+	return language
+}
+
+//nolint:gochecknoglobals
+var (
+	// languageTagRegexp matches the well-formed language tags defined by RFC 5646,
+	// i.e. language, script, region, variants, extensions and private use subtags.
+	languageTagRegexp = regexp.MustCompile(`^(?:(?:[A-Za-z]{2,3}(?:-[A-Za-z]{3}){0,3}|[A-Za-z]{4,8})` +
+		`(?:-[A-Za-z]{4})?(?:-(?:[A-Za-z]{2}|\d{3}))?(?:-(?:[A-Za-z0-9]{5,8}|\d[A-Za-z0-9]{3}))*` +
+		`(?:-[0-9A-WY-Za-wy-z](?:-[A-Za-z0-9]{2,8})+)*(?:-[Xx](?:-[A-Za-z0-9]{1,8})+)?|[Xx](?:-[A-Za-z0-9]{1,8})+)$`)
+	languageNames = map[string]string{
+		"ar": "Arabic", "de": "German", "el": "Greek", "en": "English", "es": "Spanish", "fr": "French",
+		"he": "Hebrew", "hi": "Hindi", "it": "Italian", "ja": "Japanese", "ko": "Korean", "nl": "Dutch",
+		"pt": "Portuguese", "ru": "Russian", "th": "Thai", "zh": "Chinese",
+	}
+	// languageScripts are in the order of precedence for ties.
+	languageScripts = []struct {
+		language string
+		table    *unicode.RangeTable
+	}{
+		{"latin", unicode.Latin},
+		{"zh", unicode.Han},
+		{"ja", unicode.Hiragana},
+		{"ja", unicode.Katakana},
+		{"ko", unicode.Hangul},
+		{"ru", unicode.Cyrillic},
+		{"ar", unicode.Arabic},
+		{"he", unicode.Hebrew},
+		{"th", unicode.Thai},
+		{"hi", unicode.Devanagari},
+		{"el", unicode.Greek},
+	}
+	latinLanguages = []string{"en", "es", "fr", "de", "it", "pt", "nl"}
+	commonWords    = map[string][]string{
+		"the": {"en"}, "and": {"en"}, "is": {"en"}, "you": {"en"}, "what": {"en"}, "how": {"en"}, "this": {"en"},
+		"el": {"es"}, "los": {"es", "pt"}, "es": {"es"}, "y": {"es"}, "qué": {"es"}, "por": {"es", "pt"},
+		"le": {"fr"}, "les": {"fr"}, "est": {"fr"}, "et": {"fr"}, "vous": {"fr"}, "je": {"fr"}, "pas": {"fr"},
+		"der": {"de"}, "die": {"de"}, "das": {"de"}, "und": {"de"}, "ist": {"de"}, "ich": {"de"}, "nicht": {"de"},
+		"il": {"it"}, "che": {"it"}, "è": {"it"}, "gli": {"it"}, "non": {"it"}, "sono": {"it"}, "della": {"it"},
+		"o": {"pt"}, "não": {"pt"}, "é": {"pt"}, "você": {"pt"}, "uma": {"pt"}, "com": {"pt"}, "do": {"pt"},
+		"het": {"nl"}, "een": {"nl"}, "en": {"nl"}, "niet": {"nl"}, "ik": {"nl"}, "wat": {"nl"}, "zijn": {"nl"},
+		"de": {"es", "fr", "pt", "nl"}, "la": {"es", "fr", "it"}, "que": {"es", "fr", "pt"}, "un": {"es", "fr", "it"},
+		// Greetings and small talk, which are common in short messages.
+		"hello": {"en"}, "thanks": {"en"}, "hola": {"es"}, "cómo": {"es"}, "estás": {"es"}, "gracias": {"es"},
+		"bonjour": {"fr"}, "merci": {"fr"}, "comment": {"fr"}, "danke": {"de"}, "wie": {"de"}, "geht": {"de"},
+		"ciao": {"it"}, "come": {"it"}, "stai": {"it"}, "grazie": {"it"}, "olá": {"pt"}, "tudo": {"pt"},
+		"bem": {"pt"}, "obrigado": {"pt"}, "está": {"es", "pt"}, "hoe": {"nl"}, "gaat": {"nl"}, "bedankt": {"nl"},
+	}
+)
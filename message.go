@@ -4,16 +4,32 @@
 package coagent
 
 import (
+	"encoding/json"
 	"io"
+	"strings"
 
 	"github.com/ktong/coagent/internal/embedded"
 )
 
+// Roles of the message author.
+//
+// Messages with RoleSystem or RoleDeveloper provide per-run instructions in addition to Agent.Instructions,
+// which Runner implementations map to the provider, e.g. additional instructions of OpenAI runs
+// or system blocks of Anthropic messages.
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleSystem    = "system"
+	RoleDeveloper = "developer"
+)
+
 type (
 	Message struct {
 		Role    string
 		Content []Content
 		Tools   []Tool
+		// Metadata are the key-value pairs attached to the message on the provider side.
+		Metadata map[string]string
 	}
 	Content interface {
 		embedded.Content
@@ -32,5 +48,62 @@ type (
 		embedded.Content
 
 		Image io.Reader
+		// Detail is the level of detail the model uses to understand the image. Empty means DetailAuto.
+		Detail ImageDetail
+	}
+
+	// ToolCall is a call of a tool by the model in the history of messages,
+	// so the calls could be displayed, e.g. "agent used get_weather(...)".
+	ToolCall struct {
+		embedded.Content
+
+		ID   string
+		Name string
+		// Arguments are the arguments of the call in JSON.
+		Arguments string
+	}
+
+	// ToolResult is the output of a tool call in the history of messages.
+	ToolResult struct {
+		embedded.Content
+
+		// CallID is the ID of the corresponding ToolCall.
+		CallID string
+		Output string
+	}
+
+	// RawContent is a provider-specific content part which is passed to the provider untouched,
+	// so new features of the provider could be used before typed content supports them.
+	// Runner implementations should ignore raw content for other providers.
+	RawContent struct {
+		embedded.Content
+
+		// Provider is the name of the provider, e.g. openai.
+		Provider string
+		Data     json.RawMessage
 	}
 )
+
+// SplitInstructions separates the text of messages with RoleSystem or RoleDeveloper from the other messages,
+// for Runner implementations whose provider takes per-run instructions separately from the conversation.
+// It returns the instructions joined by blank lines, and the remaining messages in order.
+func SplitInstructions(messages []Message) (string, []Message) {
+	var (
+		instructions []string
+		conversation = make([]Message, 0, len(messages))
+	)
+	for _, message := range messages {
+		if message.Role != RoleSystem && message.Role != RoleDeveloper {
+			conversation = append(conversation, message)
+
+			continue
+		}
+		for _, content := range message.Content {
+			if text, ok := content.(Text); ok {
+				instructions = append(instructions, text.Text)
+			}
+		}
+	}
+
+	return strings.Join(instructions, "\n\n"), conversation
+}
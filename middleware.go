@@ -0,0 +1,44 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent
+
+import "context"
+
+// RunnerFunc is an adapter to allow the use of ordinary functions as Runner.
+type RunnerFunc func(ctx context.Context, agent Agent, messages []Message, opts []RunOption) (Message, error)
+
+func (f RunnerFunc) Run(ctx context.Context, agent Agent, messages []Message, opts []RunOption) (Message, error) {
+	return f(ctx, agent, messages, opts)
+}
+
+// RunnerMiddleware wraps a Runner to add cross-cutting behaviors, e.g. caching, guardrails and logging,
+// which compose identically regardless of the Runner implementation.
+type RunnerMiddleware func(Runner) Runner
+
+// Chain returns a Runner which runs through the middlewares before the provided runner.
+// The first middleware is the outermost one, which sees the run first.
+//
+// The returned Runner reports the capabilities of the provided runner and pings it.
+func Chain(runner Runner, middlewares ...RunnerMiddleware) Runner {
+	chained := chainedRunner{Runner: runner, base: runner}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		chained.Runner = middlewares[i](chained.Runner)
+	}
+
+	return chained
+}
+
+type chainedRunner struct {
+	Runner
+
+	base Runner
+}
+
+func (c chainedRunner) Capabilities() Capabilities {
+	return RunnerCapabilities(c.base)
+}
+
+func (c chainedRunner) Ping(ctx context.Context) error {
+	return Ping(ctx, c.base)
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+// Package models provides a provider-agnostic registry of known models
+// with their capabilities and pricing.
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/ktong/coagent"
+)
+
+// Model describes the capabilities and pricing of a model.
+type Model struct {
+	Name string
+	// ContextWindow is the maximum number of tokens in the context, including the output.
+	ContextWindow int
+	// MaxOutputTokens is the maximum number of tokens the model generates for a response.
+	MaxOutputTokens int
+
+	Vision     bool
+	Tools      bool
+	JSONSchema bool
+
+	// InputPrice and OutputPrice are the prices in USD per million tokens.
+	InputPrice  float64
+	OutputPrice float64
+}
+
+// Cost returns the cost in USD for the provided number of input and output tokens.
+func (m Model) Cost(inputTokens, outputTokens int) float64 {
+	const million = 1_000_000
+
+	return (float64(inputTokens)*m.InputPrice + float64(outputTokens)*m.OutputPrice) / million
+}
+
+// Capabilities returns the capabilities of the model as reported by coagent.Runner implementations.
+func (m Model) Capabilities() coagent.Capabilities {
+	return coagent.Capabilities{
+		ImageInput:       m.Vision,
+		JSONSchemaOutput: m.JSONSchema,
+		MaxContextTokens: m.ContextWindow,
+	}
+}
+
+// Register adds the model to the registry, or overrides the registered model with the same name,
+// e.g. for models unknown to this package or changes of pricing.
+func Register(model Model) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	registry.models[model.Name] = model
+}
+
+// Lookup returns the registered model with the provided name, and whether it's found.
+// Names of snapshots match the registered model without the snapshot suffix,
+// which is a date (e.g. gpt-4o-2024-08-06 or claude-3-5-sonnet-20241022), a version (e.g. gemini-1.5-pro-002)
+// or latest (e.g. claude-3-5-sonnet-latest). Other variants (e.g. gpt-4-32k) are distinct models
+// and must be registered explicitly.
+func Lookup(name string) (Model, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	if model, ok := registry.models[name]; ok {
+		return model, true
+	}
+	if match := snapshotRegexp.FindStringSubmatch(name); match != nil {
+		model, ok := registry.models[match[1]]
+
+		return model, ok
+	}
+
+	return Model{}, false
+}
+
+//nolint:gochecknoglobals
+var snapshotRegexp = regexp.MustCompile(`^(.+)-(?:\d{4}-\d{2}-\d{2}|\d{8}|\d{3,4}|latest)$`)
+
+// ErrUnsupportedFeature is returned by Validate if the agent or messages use a feature
+// that the model does not support.
+var ErrUnsupportedFeature = errors.New("unsupported feature")
+
+// Validate verifies the model of the agent supports the features used by the agent and messages,
+// e.g. image content requires a model with vision.
+// If the model is not registered, it's not validated.
+func Validate(agent coagent.Agent, messages []coagent.Message) error {
+	model, ok := Lookup(agent.Model)
+	if !ok {
+		return nil
+	}
+
+	if len(agent.Tools) > 0 && !model.Tools {
+		return fmt.Errorf("agent %s uses tools but model %s doesn't support them: %w",
+			agent.Name, model.Name, ErrUnsupportedFeature)
+	}
+	for _, message := range messages {
+		for _, content := range message.Content {
+			if _, isImage := content.(coagent.Image); isImage && !model.Vision {
+				return fmt.Errorf("agent %s uses image content but model %s doesn't support vision: %w",
+					agent.Name, model.Name, ErrUnsupportedFeature)
+			}
+		}
+	}
+
+	return nil
+}
+
+//nolint:gochecknoglobals,mnd
+var registry = struct {
+	sync.RWMutex
+
+	models map[string]Model
+}{
+	models: map[string]Model{
+		"gpt-4o": {
+			Name: "gpt-4o", ContextWindow: 128_000, MaxOutputTokens: 16_384,
+			Vision: true, Tools: true, JSONSchema: true, InputPrice: 2.5, OutputPrice: 10,
+		},
+		"gpt-4o-mini": {
+			Name: "gpt-4o-mini", ContextWindow: 128_000, MaxOutputTokens: 16_384,
+			Vision: true, Tools: true, JSONSchema: true, InputPrice: 0.15, OutputPrice: 0.6,
+		},
+		"gpt-4-turbo": {
+			Name: "gpt-4-turbo", ContextWindow: 128_000, MaxOutputTokens: 4_096,
+			Vision: true, Tools: true, InputPrice: 10, OutputPrice: 30,
+		},
+		"gpt-4": {
+			Name: "gpt-4", ContextWindow: 8_192, MaxOutputTokens: 8_192,
+			Tools: true, InputPrice: 30, OutputPrice: 60,
+		},
+		"gpt-3.5-turbo": {
+			Name: "gpt-3.5-turbo", ContextWindow: 16_385, MaxOutputTokens: 4_096,
+			Tools: true, InputPrice: 0.5, OutputPrice: 1.5,
+		},
+		"o1": {
+			Name: "o1", ContextWindow: 200_000, MaxOutputTokens: 100_000,
+			Vision: true, Tools: true, JSONSchema: true, InputPrice: 15, OutputPrice: 60,
+		},
+		"claude-3-5-sonnet": {
+			Name: "claude-3-5-sonnet", ContextWindow: 200_000, MaxOutputTokens: 8_192,
+			Vision: true, Tools: true, InputPrice: 3, OutputPrice: 15,
+		},
+		"claude-3-5-haiku": {
+			Name: "claude-3-5-haiku", ContextWindow: 200_000, MaxOutputTokens: 8_192,
+			Tools: true, InputPrice: 0.8, OutputPrice: 4,
+		},
+		"claude-3-opus": {
+			Name: "claude-3-opus", ContextWindow: 200_000, MaxOutputTokens: 4_096,
+			Vision: true, Tools: true, InputPrice: 15, OutputPrice: 75,
+		},
+		"gemini-1.5-pro": {
+			Name: "gemini-1.5-pro", ContextWindow: 2_097_152, MaxOutputTokens: 8_192,
+			Vision: true, Tools: true, JSONSchema: true, InputPrice: 1.25, OutputPrice: 5,
+		},
+		"gemini-1.5-flash": {
+			Name: "gemini-1.5-flash", ContextWindow: 1_048_576, MaxOutputTokens: 8_192,
+			Vision: true, Tools: true, JSONSchema: true, InputPrice: 0.075, OutputPrice: 0.3,
+		},
+	},
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package models_test
+
+import (
+	"testing"
+
+	"github.com/ktong/coagent/internal/assert"
+	"github.com/ktong/coagent/models"
+)
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		description string
+		name        string
+		model       string
+		found       bool
+	}{
+		{description: "registered model", name: "gpt-4o", model: "gpt-4o", found: true},
+		{description: "dated snapshot", name: "gpt-4o-2024-08-06", model: "gpt-4o", found: true},
+		{description: "dated snapshot of longer name", name: "gpt-4o-mini-2024-07-18", model: "gpt-4o-mini", found: true},
+		{description: "compact dated snapshot", name: "claude-3-5-sonnet-20241022", model: "claude-3-5-sonnet", found: true},
+		{description: "versioned snapshot", name: "gemini-1.5-pro-002", model: "gemini-1.5-pro", found: true},
+		{description: "short dated snapshot", name: "gpt-4-0613", model: "gpt-4", found: true},
+		{description: "latest", name: "claude-3-5-haiku-latest", model: "claude-3-5-haiku", found: true},
+		{description: "distinct mini model", name: "o1-mini"},
+		{description: "distinct context window", name: "gpt-4-32k"},
+		{description: "distinct instruct model", name: "gpt-3.5-turbo-instruct"},
+		{description: "snapshot of unknown model", name: "unknown-2024-08-06"},
+		{description: "unknown model", name: "unknown"},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			model, found := models.Lookup(testcase.name)
+			assert.Equal(t, testcase.found, found)
+			assert.Equal(t, testcase.model, model.Name)
+		})
+	}
+}
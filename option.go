@@ -3,8 +3,278 @@
 
 package coagent
 
-import "github.com/ktong/coagent/internal/embedded"
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/ktong/coagent/internal/embedded"
+)
 
 type RunOption interface {
 	embedded.RunOption
 }
+
+// RunConfig is the configuration of a run built from the RunOption(s) passed to the Runner.
+// Runner implementations should use NewRunConfig to read the options they support,
+// and return an error for any option they do not support rather than ignoring it silently.
+type RunConfig struct {
+	// JSONMode constrains the model to respond with a valid JSON object.
+	JSONMode bool
+	// Timeout is the maximum duration of the entire run. Zero means no timeout.
+	Timeout time.Duration
+	// MaxDepth is the maximum nesting depth of agents running other agents.
+	// Zero means the default depth of 8.
+	MaxDepth int
+	// StopSequences are the sequences where the model stops generating further tokens.
+	StopSequences []string
+	// Seed makes the sampling deterministic on a best-effort basis if it's not nil.
+	Seed *int64
+	// Locale is the BCP 47 language tag the model responds in.
+	Locale string
+	// User identifies the end-user of the run to the provider for abuse monitoring and analytics.
+	User string
+	// MaxTokens is the maximum number of tokens the model generates. Zero means no limit.
+	MaxTokens int
+	// Priority is the priority of the run when it's queued, e.g. by RunScheduler. Higher runs first.
+	Priority int
+	// Metadata are the key-value pairs attached to the run on the provider side.
+	Metadata map[string]string
+	// ExtraBody are the fields merged into the request bodies sent to the provider.
+	ExtraBody map[string]any
+	// Overrides are the changes to the agent for the run.
+	Overrides Overrides
+	// Result is filled with the outcome of the run if it's not nil.
+	Result *RunResult
+
+	// Others are the options not defined by this package, e.g. options specific to a Runner implementation.
+	// Runner implementations should apply the ones they support
+	// and return the error from UnsupportedOption for the others.
+	Others []RunOption
+}
+
+// NewRunConfig returns the RunConfig built from the provided options.
+// If the same option is provided multiple times, the latter one takes precedence.
+//
+// It returns an error wrapping ErrInvalidOption if any option has an invalid value.
+func NewRunConfig(opts []RunOption) (RunConfig, error) {
+	var config RunConfig
+	for _, opt := range opts {
+		option, ok := opt.(funcOption)
+		if !ok {
+			config.Others = append(config.Others, opt)
+
+			continue
+		}
+		if err := option.fn(&config); err != nil {
+			return RunConfig{}, fmt.Errorf("%s: %w", option.name, err)
+		}
+	}
+
+	return config, nil
+}
+
+// UnsupportedOption returns an error wrapping ErrUnsupportedOption for the provided option,
+// which Runner implementations return for options they do not support.
+func UnsupportedOption(opt RunOption) error {
+	if option, ok := opt.(funcOption); ok {
+		return fmt.Errorf("%s: %w", option.name, ErrUnsupportedOption)
+	}
+
+	return fmt.Errorf("%T: %w", opt, ErrUnsupportedOption)
+}
+
+// WithJSONMode constrains the model to respond with a valid JSON object,
+// which is useful if a full response schema is overkill.
+//
+// Agent.Run also appends instructions asking the model to respond in JSON
+// if the instructions of the agent do not mention it, as required by the providers.
+func WithJSONMode() RunOption {
+	return funcOption{name: "WithJSONMode", fn: func(config *RunConfig) error {
+		config.JSONMode = true
+
+		return nil
+	}}
+}
+
+// WithRunTimeout limits the duration of the entire run, including tool calls.
+// On expiry, the run is canceled and Agent.Run returns ErrRunTimeout.
+//
+// Runner implementations should cancel the run on the provider side once the context is done.
+func WithRunTimeout(timeout time.Duration) RunOption {
+	return funcOption{name: "WithRunTimeout", fn: func(config *RunConfig) error {
+		if timeout < 0 {
+			return fmt.Errorf("%w: negative timeout %v", ErrInvalidOption, timeout)
+		}
+		config.Timeout = timeout
+
+		return nil
+	}}
+}
+
+// WithMaxDepth limits the nesting depth of agents running other agents (e.g. as tools),
+// so Agent.Run returns ErrMaxDepthExceeded rather than recursing infinitely
+// when agents accidentally call each other. Zero means the default depth of 8.
+//
+// The limit is carried by the context of the run, so it also applies to the nested runs,
+// which could only lower it with their own options.
+func WithMaxDepth(depth int) RunOption {
+	return funcOption{name: "WithMaxDepth", fn: func(config *RunConfig) error {
+		if depth < 0 {
+			return fmt.Errorf("%w: negative depth %d", ErrInvalidOption, depth)
+		}
+		config.MaxDepth = depth
+
+		return nil
+	}}
+}
+
+// WithStopSequences sets the sequences where the model stops generating further tokens.
+func WithStopSequences(sequences ...string) RunOption {
+	return funcOption{name: "WithStopSequences", fn: func(config *RunConfig) error {
+		if slices.Contains(sequences, "") {
+			return fmt.Errorf("%w: empty stop sequence", ErrInvalidOption)
+		}
+		config.StopSequences = sequences
+
+		return nil
+	}}
+}
+
+// WithSeed sets the seed for sampling, so repeated runs with the same seed and messages
+// return the same result on a best-effort basis, for providers which support reproducibility.
+func WithSeed(seed int64) RunOption {
+	return funcOption{name: "WithSeed", fn: func(config *RunConfig) error {
+		config.Seed = &seed
+
+		return nil
+	}}
+}
+
+// WithUser identifies the end-user of the run to the provider, e.g. the user field of OpenAI,
+// for abuse monitoring and per-user analytics. It should not contain personal information.
+func WithUser(userID string) RunOption {
+	return funcOption{name: "WithUser", fn: func(config *RunConfig) error {
+		config.User = userID
+
+		return nil
+	}}
+}
+
+// WithMaxTokens limits the number of tokens the model generates for the response.
+func WithMaxTokens(tokens int) RunOption {
+	return funcOption{name: "WithMaxTokens", fn: func(config *RunConfig) error {
+		if tokens < 0 {
+			return fmt.Errorf("%w: negative max tokens %d", ErrInvalidOption, tokens)
+		}
+		config.MaxTokens = tokens
+
+		return nil
+	}}
+}
+
+// WithPriority sets the priority of the run when it's queued, e.g. by RunScheduler.
+// Runs with higher priority run first, and the default priority is 0.
+func WithPriority(priority int) RunOption {
+	return funcOption{name: "WithPriority", fn: func(config *RunConfig) error {
+		config.Priority = priority
+
+		return nil
+	}}
+}
+
+// WithMetadata attaches the key-value pairs to the run on the provider side,
+// e.g. for tracing the run back to the application.
+// If it's provided multiple times, the pairs are merged with the latter taking precedence.
+func WithMetadata(metadata map[string]string) RunOption {
+	return funcOption{name: "WithMetadata", fn: func(config *RunConfig) error {
+		if config.Metadata == nil {
+			config.Metadata = make(map[string]string, len(metadata))
+		}
+		maps.Copy(config.Metadata, metadata)
+
+		return nil
+	}}
+}
+
+// WithExtraBody merges the fields into the request bodies sent to the provider,
+// e.g. for beta parameters which are not supported by typed options yet.
+// If it's provided multiple times, the fields are merged with the latter taking precedence.
+//
+// Runner implementations should use MergeExtraBody to merge the fields into request bodies.
+func WithExtraBody(fields map[string]any) RunOption {
+	return funcOption{name: "WithExtraBody", fn: func(config *RunConfig) error {
+		if config.ExtraBody == nil {
+			config.ExtraBody = make(map[string]any, len(fields))
+		}
+		maps.Copy(config.ExtraBody, fields)
+
+		return nil
+	}}
+}
+
+// MergeExtraBody merges the extra fields into the JSON object of a request body.
+// It returns an error wrapping ErrInvalidOption if any field conflicts with a field in the body,
+// which is set by typed options.
+func MergeExtraBody(body []byte, extra map[string]any) ([]byte, error) {
+	if len(extra) == 0 {
+		return body, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("unmarshal request body: %w", err)
+	}
+	if fields == nil {
+		fields = make(map[string]json.RawMessage, len(extra))
+	}
+	for name, value := range extra {
+		if _, exists := fields[name]; exists {
+			return nil, fmt.Errorf("%w: extra field %q conflicts with the request", ErrInvalidOption, name)
+		}
+
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("marshal extra field %q: %w", name, err)
+		}
+		fields[name] = raw
+	}
+
+	merged, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request body: %w", err)
+	}
+
+	return merged, nil
+}
+
+// WithOverrides changes the agent for the run, e.g. for per-request variants of a shared agent.
+// If multiple overrides are provided, their non-zero fields are merged with the latter taking precedence.
+//
+// Runner implementations should apply the overrides as run-level parameters if the provider supports them,
+// so the variant does not require re-creating the agent on the provider side.
+// Otherwise, they could use Overrides.Apply to derive the agent for the run.
+func WithOverrides(overrides Overrides) RunOption {
+	return funcOption{name: "WithOverrides", fn: func(config *RunConfig) error {
+		if overrides.Model != "" {
+			config.Overrides.Model = overrides.Model
+		}
+		if overrides.AdditionalInstructions != "" {
+			config.Overrides.AdditionalInstructions = overrides.AdditionalInstructions
+		}
+		if overrides.Tools != nil {
+			config.Overrides.Tools = overrides.Tools
+		}
+
+		return nil
+	}}
+}
+
+type funcOption struct {
+	embedded.RunOption
+
+	name string
+	fn   func(*RunConfig) error
+}
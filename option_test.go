@@ -0,0 +1,92 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ktong/coagent"
+	"github.com/ktong/coagent/internal/assert"
+)
+
+func TestMergeExtraBody(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		description string
+		body        string
+		opts        []coagent.RunOption
+		merged      string
+		err         string // The prefix of the error, since the messages of encoding/json vary by Go versions.
+	}{
+		{
+			description: "no extra fields",
+			body:        `{"model": "gpt-4o"}`,
+			merged:      `{"model": "gpt-4o"}`,
+		},
+		{
+			description: "empty extra fields",
+			body:        `{"model": "gpt-4o"}`,
+			opts:        []coagent.RunOption{coagent.WithExtraBody(map[string]any{})},
+			merged:      `{"model": "gpt-4o"}`,
+		},
+		{
+			description: "extra fields",
+			body:        `{"model": "gpt-4o"}`,
+			opts:        []coagent.RunOption{coagent.WithExtraBody(map[string]any{"reasoning": map[string]any{"effort": "low"}})},
+			merged:      `{"model":"gpt-4o","reasoning":{"effort":"low"}}`,
+		},
+		{
+			description: "null body",
+			body:        `null`,
+			opts:        []coagent.RunOption{coagent.WithExtraBody(map[string]any{"store": true})},
+			merged:      `{"store":true}`,
+		},
+		{
+			description: "latter extra fields take precedence",
+			body:        `{}`,
+			opts: []coagent.RunOption{
+				coagent.WithExtraBody(map[string]any{"store": true, "service_tier": "flex"}),
+				coagent.WithExtraBody(map[string]any{"store": false}),
+			},
+			merged: `{"service_tier":"flex","store":false}`,
+		},
+		{
+			description: "non-object body",
+			body:        `[1]`,
+			opts:        []coagent.RunOption{coagent.WithExtraBody(map[string]any{"store": true})},
+			err:         "unmarshal request body: json: cannot unmarshal array into Go value of type map[string]",
+		},
+		{
+			description: "conflicting field",
+			body:        `{"model": "gpt-4o"}`,
+			opts:        []coagent.RunOption{coagent.WithExtraBody(map[string]any{"model": "gpt-4o-mini"})},
+			err:         `invalid run option: extra field "model" conflicts with the request`,
+		},
+		{
+			description: "unmarshalable field",
+			body:        `{}`,
+			opts:        []coagent.RunOption{coagent.WithExtraBody(map[string]any{"callback": func() {}})},
+			err:         `marshal extra field "callback": json: unsupported type: func()`,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			config, err := coagent.NewRunConfig(testcase.opts)
+			assert.NoError(t, err)
+			merged, err := coagent.MergeExtraBody([]byte(testcase.body), config.ExtraBody)
+			if testcase.err != "" {
+				assert.Equal(t, true, err != nil && strings.HasPrefix(err.Error(), testcase.err))
+
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, testcase.merged, string(merged))
+		})
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent
+
+import (
+	"context"
+	"slices"
+)
+
+// Caller is the identity of the caller of a run, e.g. the end-user of a multi-user deployment.
+type Caller struct {
+	ID    string
+	Roles []string
+}
+
+// HasRole reports whether the caller has the role.
+func (c Caller) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+// WithCaller returns a copy of the context carrying the caller of runs.
+func WithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext returns the caller carried by the context, and whether it's found.
+func CallerFromContext(ctx context.Context) (Caller, bool) {
+	caller, ok := ctx.Value(callerKey{}).(Caller)
+
+	return caller, ok
+}
+
+type callerKey struct{}
+
+// ToolPolicy is the interface that wraps the Allow method.
+//
+// Allow reports whether the model may see and call the tool in the run,
+// usually by the caller carried by the context (see CallerFromContext).
+type ToolPolicy interface {
+	Allow(ctx context.Context, agent Agent, tool Tool) bool
+}
+
+// ToolPolicyFunc is an adapter to allow the use of ordinary functions as ToolPolicy.
+type ToolPolicyFunc func(ctx context.Context, agent Agent, tool Tool) bool
+
+func (f ToolPolicyFunc) Allow(ctx context.Context, agent Agent, tool Tool) bool {
+	return f(ctx, agent, tool)
+}
+
+// AuthorizeTools returns a RunnerMiddleware which evaluates the policy for each run,
+// and only provides the allowed tools of the agent and messages to the model.
+// The agent passed to the next runner only has the allowed tools, and they are also set as run-level overrides
+// (see WithOverrides), so runners applying either of them never see the denied tools.
+func AuthorizeTools(policy ToolPolicy) RunnerMiddleware {
+	return func(runner Runner) Runner {
+		return RunnerFunc(func(ctx context.Context, agent Agent, messages []Message, opts []RunOption) (Message, error) {
+			tools, err := EffectiveTools(agent, nil, opts)
+			if err != nil {
+				return Message{}, err
+			}
+
+			allowed := func(tools []Tool) []Tool {
+				return slices.DeleteFunc(slices.Clone(tools), func(tool Tool) bool {
+					return !policy.Allow(ctx, agent, tool)
+				})
+			}
+
+			filtered := allowed(tools)
+			if len(filtered) < len(tools) {
+				opts = append(slices.Clip(opts), WithOverrides(Overrides{Tools: filtered}))
+			}
+			agent = agent.Clone()
+			agent.Tools = filtered
+
+			messages = slices.Clone(messages)
+			for i := range messages {
+				messages[i].Tools = allowed(messages[i].Tools)
+			}
+
+			return runner.Run(ctx, agent, messages, opts)
+		})
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ktong/coagent"
+	"github.com/ktong/coagent/internal/assert"
+	"github.com/ktong/coagent/internal/embedded"
+)
+
+func TestAuthorizeTools(t *testing.T) {
+	t.Parallel()
+
+	var (
+		search = namedTool{name: "search"}
+		remove = namedTool{name: "delete"}
+		admin  = namedTool{name: "admin"}
+	)
+	policy := coagent.ToolPolicyFunc(func(ctx context.Context, _ coagent.Agent, tool coagent.Tool) bool {
+		caller, _ := coagent.CallerFromContext(ctx)
+
+		return tool != remove && tool != admin || caller.HasRole("admin")
+	})
+
+	testcases := []struct {
+		description string
+		caller      coagent.Caller
+		opts        []coagent.RunOption
+		agentTools  []string
+		tools       []string
+	}{
+		{
+			description: "denied tools",
+			agentTools:  []string{"search"},
+			tools:       []string{"search"},
+		},
+		{
+			description: "allowed tools",
+			caller:      coagent.Caller{Roles: []string{"admin"}},
+			agentTools:  []string{"search", "delete"},
+			tools:       []string{"search", "delete", "admin"},
+		},
+		{
+			description: "denied override tools",
+			opts:        []coagent.RunOption{coagent.WithOverrides(coagent.Overrides{Tools: []coagent.Tool{remove}})},
+		},
+		{
+			description: "allowed override tools",
+			opts:        []coagent.RunOption{coagent.WithOverrides(coagent.Overrides{Tools: []coagent.Tool{search}})},
+			agentTools:  []string{"search"},
+			tools:       []string{"search"},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			runner := coagent.Chain(
+				coagent.RunnerFunc(func(
+					_ context.Context, agent coagent.Agent, messages []coagent.Message, opts []coagent.RunOption,
+				) (coagent.Message, error) {
+					// Both the agent and the effective tools must not carry the denied tools.
+					assert.Equal(t, testcase.agentTools, toolNames(agent.Tools))
+					tools, err := coagent.EffectiveTools(agent, messages, opts)
+					assert.NoError(t, err)
+					assert.Equal(t, testcase.tools, toolNames(tools))
+
+					return coagent.Message{}, nil
+				}),
+				coagent.AuthorizeTools(policy),
+			)
+			agent := coagent.Agent{Name: "agent", Tools: []coagent.Tool{search, remove}}
+			messages := []coagent.Message{{Role: coagent.RoleUser, Tools: []coagent.Tool{admin}}}
+
+			_, err := runner.Run(coagent.WithCaller(context.Background(), testcase.caller), agent, messages, testcase.opts)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+type namedTool struct {
+	embedded.Tool
+
+	name string
+}
+
+func toolNames(tools []coagent.Tool) []string {
+	var names []string
+	for _, tool := range tools {
+		names = append(names, tool.(namedTool).name) //nolint:forcetypeassert
+	}
+
+	return names
+}
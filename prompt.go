@@ -0,0 +1,64 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// PromptFragment is a reusable part of instructions, e.g. persona, constraints, tone and output format,
+// which is composed into Agent.Instructions by ComposeInstructions.
+type PromptFragment struct {
+	// Name identifies the fragment. A fragment overrides the earlier fragment with the same name.
+	Name string
+	// Order is the position of the fragment in the instructions, e.g. OrderPersona.
+	// Fragments with lower order come first, and the ones with the same order keep their relative order.
+	Order int
+	// Text is the text of the fragment. An empty text removes the earlier fragment with the same name.
+	Text string
+	// Locked prevents the fragment from being overridden or removed by later fragments,
+	// e.g. for a safety preamble which is enforced across all agents of an organization.
+	Locked bool
+}
+
+// Orders of the common kinds of fragments.
+const (
+	OrderPreamble     = 0
+	OrderPersona      = 100
+	OrderConstraints  = 200
+	OrderTone         = 300
+	OrderOutputFormat = 400
+)
+
+// ComposeInstructions composes the fragments into instructions, with the fragments separated by blank lines.
+func ComposeInstructions(fragments ...PromptFragment) string {
+	var composed []PromptFragment
+	for _, fragment := range fragments {
+		index := slices.IndexFunc(composed, func(f PromptFragment) bool {
+			return fragment.Name != "" && f.Name == fragment.Name
+		})
+		switch {
+		case index < 0:
+			composed = append(composed, fragment)
+		case composed[index].Locked:
+			continue
+		default:
+			composed[index] = fragment
+		}
+	}
+	slices.SortStableFunc(composed, func(a, b PromptFragment) int {
+		return cmp.Compare(a.Order, b.Order)
+	})
+
+	texts := make([]string, 0, len(composed))
+	for _, fragment := range composed {
+		if text := strings.TrimSpace(fragment.Text); text != "" {
+			texts = append(texts, text)
+		}
+	}
+
+	return strings.Join(texts, "\n\n")
+}
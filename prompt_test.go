@@ -0,0 +1,88 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent_test
+
+import (
+	"testing"
+
+	"github.com/ktong/coagent"
+	"github.com/ktong/coagent/internal/assert"
+)
+
+func TestComposeInstructions(t *testing.T) {
+	t.Parallel()
+
+	preamble := coagent.PromptFragment{Name: "safety", Order: coagent.OrderPreamble, Text: "Be safe.", Locked: true}
+	persona := coagent.PromptFragment{Name: "persona", Order: coagent.OrderPersona, Text: "You are a librarian."}
+	tone := coagent.PromptFragment{Name: "tone", Order: coagent.OrderTone, Text: "Be friendly."}
+
+	testcases := []struct {
+		description  string
+		fragments    []coagent.PromptFragment
+		instructions string
+	}{
+		{
+			description: "no fragments",
+		},
+		{
+			description:  "sorted by order",
+			fragments:    []coagent.PromptFragment{tone, persona, preamble},
+			instructions: "Be safe.\n\nYou are a librarian.\n\nBe friendly.",
+		},
+		{
+			description: "stable for same order",
+			fragments: []coagent.PromptFragment{
+				{Order: coagent.OrderConstraints, Text: "No jokes."},
+				persona,
+				{Order: coagent.OrderConstraints, Text: "No emojis."},
+			},
+			instructions: "You are a librarian.\n\nNo jokes.\n\nNo emojis.",
+		},
+		{
+			description: "override by name",
+			fragments: []coagent.PromptFragment{
+				persona, tone, {Name: "persona", Order: coagent.OrderPersona, Text: "You are a chef."},
+			},
+			instructions: "You are a chef.\n\nBe friendly.",
+		},
+		{
+			description:  "remove by empty text",
+			fragments:    []coagent.PromptFragment{persona, tone, {Name: "tone"}},
+			instructions: "You are a librarian.",
+		},
+		{
+			description: "locked fragment survives override and removal",
+			fragments: []coagent.PromptFragment{
+				preamble,
+				{Name: "safety", Order: coagent.OrderPreamble, Text: "Anything goes."},
+				{Name: "safety"},
+				persona,
+			},
+			instructions: "Be safe.\n\nYou are a librarian.",
+		},
+		{
+			description: "unnamed fragments never override",
+			fragments: []coagent.PromptFragment{
+				{Order: coagent.OrderTone, Text: "Be brief."},
+				{Order: coagent.OrderTone},
+			},
+			instructions: "Be brief.",
+		},
+		{
+			description: "trimmed text",
+			fragments: []coagent.PromptFragment{
+				{Name: "persona", Text: "  You are a librarian.\n"}, {Name: "blank", Text: " \n "},
+			},
+			instructions: "You are a librarian.",
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, testcase.instructions, coagent.ComposeInstructions(testcase.fragments...))
+		})
+	}
+}
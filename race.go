@@ -0,0 +1,55 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// RaceRun runs the same messages with all agents concurrently, e.g. with different models or providers,
+// and returns the first response accepted by the accept function, canceling the other runs.
+// It trades cost for the tail latency of runs. If accept is nil, any response is accepted.
+//
+// If no response is accepted, it returns an error wrapping ErrNoAcceptedResponse
+// along with the errors of the failed runs.
+func RaceRun(
+	ctx context.Context, agents []Agent, messages []Message, accept func(Message) bool, opts ...RunOption,
+) (Message, error) {
+	// Each run has its own readers of the images.
+	runMessages, err := replayableMessages(messages)
+	if err != nil {
+		return Message{}, fmt.Errorf("race run: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		message Message
+		err     error
+	}
+	results := make(chan result, len(agents))
+	for _, agent := range agents {
+		messages := runMessages()
+		go func() {
+			message, err := agent.Run(ctx, messages, opts...)
+			results <- result{message: message, err: err}
+		}()
+	}
+
+	errs := []error{ErrNoAcceptedResponse}
+	for range agents {
+		result := <-results
+		switch {
+		case result.err != nil:
+			errs = append(errs, result.err)
+		case accept == nil || accept(result.message):
+			return result.message, nil
+		}
+	}
+
+	return Message{}, fmt.Errorf("race run: %w", errors.Join(errs...))
+}
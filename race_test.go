@@ -0,0 +1,116 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ktong/coagent"
+	"github.com/ktong/coagent/internal/assert"
+)
+
+func TestRaceRun(t *testing.T) {
+	t.Parallel()
+
+	errFailed := errors.New("failed")
+
+	testcases := []struct {
+		description string
+		responses   []string // Empty means the run fails, and "wait" means the run waits until canceled.
+		accept      func(coagent.Message) bool
+		response    string
+		errs        []error
+	}{
+		{
+			description: "first response",
+			responses:   []string{"a", "wait"},
+			response:    "a",
+		},
+		{
+			description: "accepted response",
+			responses:   []string{"a", "b"},
+			accept: func(message coagent.Message) bool {
+				text, _ := message.Content[0].(coagent.Text)
+
+				return text.Text == "b"
+			},
+			response: "b",
+		},
+		{
+			description: "failed run",
+			responses:   []string{"", "b"},
+			response:    "b",
+		},
+		{
+			description: "all failed",
+			responses:   []string{"", ""},
+			errs:        []error{coagent.ErrNoAcceptedResponse, errFailed},
+		},
+		{
+			description: "all rejected",
+			responses:   []string{"a", "b"},
+			accept:      func(coagent.Message) bool { return false },
+			errs:        []error{coagent.ErrNoAcceptedResponse},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			canceled := make(chan struct{})
+			agents := make([]coagent.Agent, 0, len(testcase.responses))
+			for _, response := range testcase.responses {
+				agents = append(agents, coagent.Agent{
+					Name: response,
+					Runner: coagent.RunnerFunc(func(
+						ctx context.Context, _ coagent.Agent, messages []coagent.Message, _ []coagent.RunOption,
+					) (coagent.Message, error) {
+						// Each run must read the entire image.
+						image, _ := messages[0].Content[0].(coagent.Image)
+						data, err := io.ReadAll(image.Image)
+						assert.NoError(t, err)
+						assert.Equal(t, "image", string(data))
+
+						switch response {
+						case "":
+							return coagent.Message{}, errFailed
+						case "wait":
+							<-ctx.Done()
+							close(canceled)
+
+							return coagent.Message{}, ctx.Err()
+						default:
+							return coagent.Message{Content: []coagent.Content{coagent.Text{Text: response}}}, nil
+						}
+					}),
+				})
+			}
+
+			response, err := coagent.RaceRun(context.Background(), agents, []coagent.Message{
+				{Role: coagent.RoleUser, Content: []coagent.Content{coagent.Image{Image: strings.NewReader("image")}}},
+			}, testcase.accept)
+			if len(testcase.errs) > 0 {
+				for _, expected := range testcase.errs {
+					assert.Equal(t, true, errors.Is(err, expected))
+				}
+
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, []coagent.Content{coagent.Text{Text: testcase.response}}, response.Content)
+
+			// The other runs are canceled once a response is accepted.
+			for _, response := range testcase.responses {
+				if response == "wait" {
+					<-canceled
+				}
+			}
+		})
+	}
+}
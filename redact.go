@@ -0,0 +1,281 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Detector is the interface that detects secrets in text for Redactor.
+type Detector interface {
+	// Kind returns the kind of secrets it detects, e.g. EMAIL, which is used in placeholders.
+	Kind() string
+	// Detect returns the start and end indexes of the secrets in the text,
+	// in the same format as regexp.Regexp.FindAllStringIndex.
+	Detect(text string) [][]int
+}
+
+// RegexpDetector is a Detector which detects the secrets matching the regular expression.
+type RegexpDetector struct {
+	Name   string
+	Regexp *regexp.Regexp
+}
+
+func (d RegexpDetector) Kind() string {
+	return d.Name
+}
+
+func (d RegexpDetector) Detect(text string) [][]int {
+	return d.Regexp.FindAllStringIndex(text, -1)
+}
+
+// DefaultDetectors returns the detectors for API keys, credit card numbers and emails.
+func DefaultDetectors() []Detector {
+	return []Detector{
+		RegexpDetector{Name: "API_KEY", Regexp: apiKeyRegexp},
+		creditCardDetector{},
+		RegexpDetector{Name: "EMAIL", Regexp: emailRegexp},
+	}
+}
+
+// Redactor masks the secrets in text with placeholders, e.g. [EMAIL_1].
+// It only holds the configuration, and the mapping between placeholders and secrets
+// is kept by the Redaction created for each scope, e.g. a run, so secrets never leak across scopes.
+//
+// Its zero value uses DefaultDetectors and is ready to use.
+type Redactor struct {
+	// Detectors detect the secrets to mask. Nil means DefaultDetectors.
+	Detectors []Detector
+}
+
+// NewRedaction returns a Redaction which masks secrets with the detectors of the Redactor,
+// and keeps the mapping to restore them within its own scope.
+func (r Redactor) NewRedaction() *Redaction {
+	detectors := r.Detectors
+	if detectors == nil {
+		detectors = DefaultDetectors()
+	}
+
+	return &Redaction{detectors: detectors}
+}
+
+// Redact returns the text with secrets replaced by placeholders, which could not be restored,
+// e.g. for logs.
+func (r Redactor) Redact(text string) string {
+	return r.NewRedaction().Redact(text)
+}
+
+// Middleware returns a RunnerMiddleware which redacts the text, tool call arguments and tool results
+// of messages sent to the model, and restores the secrets in them of the response. Each run has its own Redaction,
+// which is carried by the context of the run (see RedactionFromContext), e.g. for tools which need the secrets.
+func (r Redactor) Middleware() RunnerMiddleware {
+	return func(runner Runner) Runner {
+		return RunnerFunc(func(ctx context.Context, agent Agent, messages []Message, opts []RunOption) (Message, error) {
+			redaction := r.NewRedaction()
+			messages = slices.Clone(messages)
+			for i := range messages {
+				messages[i].Content = mapText(messages[i].Content, redaction.Redact)
+			}
+
+			response, err := runner.Run(context.WithValue(ctx, redactionKey{}, redaction), agent, messages, opts)
+			if err != nil {
+				return Message{}, err
+			}
+			response.Content = mapText(response.Content, redaction.Restore)
+
+			return response, nil
+		})
+	}
+}
+
+// ReplaceAttr redacts the values of log attributes, which could be used as slog.HandlerOptions.ReplaceAttr
+// for debug logs. It resolves slog.LogValuer values, and redacts strings, errors, fmt.Stringer values
+// and the members of groups. Other values are not redacted.
+func (r Redactor) ReplaceAttr(groups []string, attr slog.Attr) slog.Attr {
+	attr.Value = attr.Value.Resolve()
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		attr.Value = slog.StringValue(r.Redact(attr.Value.String()))
+	case slog.KindGroup:
+		members := slices.Clone(attr.Value.Group())
+		for i, member := range members {
+			members[i] = r.ReplaceAttr(append(slices.Clip(groups), attr.Key), member)
+		}
+		attr.Value = slog.GroupValue(members...)
+	case slog.KindAny:
+		switch value := attr.Value.Any().(type) {
+		case error:
+			attr.Value = slog.StringValue(r.Redact(value.Error()))
+		case fmt.Stringer:
+			attr.Value = slog.StringValue(r.Redact(value.String()))
+		}
+	default:
+		// Other kinds, e.g. numbers and times, could not contain secrets.
+	}
+
+	return attr
+}
+
+// Redaction masks the secrets in text with placeholders, and keeps the mapping so the original secrets
+// could be restored, e.g. for tool calls which need them. The same secret is always masked with the same placeholder,
+// and only the placeholders produced by the Redaction are restored.
+//
+// It's safe to use a Redaction concurrently.
+type Redaction struct {
+	detectors []Detector
+
+	mu           sync.RWMutex
+	placeholders map[string]string
+	originals    map[string]string
+	counts       map[string]int
+}
+
+// RedactionFromContext returns the Redaction of the run carried by the context, and whether it's found.
+func RedactionFromContext(ctx context.Context) (*Redaction, bool) {
+	redaction, ok := ctx.Value(redactionKey{}).(*Redaction)
+
+	return redaction, ok
+}
+
+type redactionKey struct{}
+
+// Redact returns the text with secrets replaced by placeholders.
+func (r *Redaction) Redact(text string) string {
+	type secret struct {
+		start, end int
+		kind       string
+	}
+	var secrets []secret
+	for _, detector := range r.detectors {
+		for _, index := range detector.Detect(text) {
+			secrets = append(secrets, secret{start: index[0], end: index[1], kind: detector.Kind()})
+		}
+	}
+	if len(secrets) == 0 {
+		return text
+	}
+	slices.SortStableFunc(secrets, func(a, b secret) int { return a.start - b.start })
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var (
+		redacted strings.Builder
+		last     int
+	)
+	for _, secret := range secrets {
+		if secret.start < last {
+			continue // Overlaps with the previous secret.
+		}
+		redacted.WriteString(text[last:secret.start])
+		redacted.WriteString(r.placeholder(secret.kind, text[secret.start:secret.end]))
+		last = secret.end
+	}
+	redacted.WriteString(text[last:])
+
+	return redacted.String()
+}
+
+func (r *Redaction) placeholder(kind, original string) string {
+	if placeholder, ok := r.placeholders[original]; ok {
+		return placeholder
+	}
+
+	if r.placeholders == nil {
+		r.placeholders = make(map[string]string)
+		r.originals = make(map[string]string)
+		r.counts = make(map[string]int)
+	}
+	r.counts[kind]++
+	placeholder := "[" + kind + "_" + strconv.Itoa(r.counts[kind]) + "]"
+	r.placeholders[original] = placeholder
+	r.originals[placeholder] = original
+
+	return placeholder
+}
+
+// Restore returns the text with the placeholders produced by the Redaction replaced by the original secrets.
+func (r *Redaction) Restore(text string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.originals) == 0 {
+		return text
+	}
+
+	pairs := make([]string, 0, 2*len(r.originals)) //nolint:mnd
+	for placeholder, original := range r.originals {
+		pairs = append(pairs, placeholder, original)
+	}
+
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// mapText applies the mapping to the text of the contents, including the arguments of tool calls
+// and the output of tool results.
+func mapText(contents []Content, mapping func(string) string) []Content {
+	contents = slices.Clone(contents)
+	for i, content := range contents {
+		switch content := content.(type) {
+		case Text:
+			content.Text = mapping(content.Text)
+			contents[i] = content
+		case ToolCall:
+			content.Arguments = mapping(content.Arguments)
+			contents[i] = content
+		case ToolResult:
+			content.Output = mapping(content.Output)
+			contents[i] = content
+		}
+	}
+
+	return contents
+}
+
+// creditCardDetector detects credit card numbers which pass the Luhn check.
+type creditCardDetector struct{}
+
+func (creditCardDetector) Kind() string {
+	return "CREDIT_CARD"
+}
+
+func (creditCardDetector) Detect(text string) [][]int {
+	return slices.DeleteFunc(creditCardRegexp.FindAllStringIndex(text, -1), func(index []int) bool {
+		return !luhnValid(text[index[0]:index[1]])
+	})
+}
+
+func luhnValid(number string) bool {
+	var sum, digits int
+	for i := len(number) - 1; i >= 0; i-- {
+		if number[i] < '0' || number[i] > '9' {
+			continue
+		}
+		digit := int(number[i] - '0')
+		if digits%2 == 1 {
+			digit *= 2
+			if digit > 9 { //nolint:mnd
+				digit -= 9
+			}
+		}
+		sum += digit
+		digits++
+	}
+
+	return sum%10 == 0 //nolint:mnd
+}
+
+//nolint:gochecknoglobals
+var (
+	apiKeyRegexp     = regexp.MustCompile(`\b(?:sk-[A-Za-z0-9_-]{20,}|AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,})\b`)
+	creditCardRegexp = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	emailRegexp      = regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)
+)
@@ -0,0 +1,214 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"regexp"
+	"testing"
+
+	"github.com/ktong/coagent"
+	"github.com/ktong/coagent/internal/assert"
+)
+
+func TestRedaction(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		description string
+		detectors   []coagent.Detector
+		text        string
+		redacted    string
+	}{
+		{
+			description: "no secrets",
+			text:        "hello world",
+			redacted:    "hello world",
+		},
+		{
+			description: "email",
+			text:        "my email is alice@corp.com",
+			redacted:    "my email is [EMAIL_1]",
+		},
+		{
+			description: "same secret with same placeholder",
+			text:        "alice@corp.com, bob@corp.com and alice@corp.com",
+			redacted:    "[EMAIL_1], [EMAIL_2] and [EMAIL_1]",
+		},
+		{
+			description: "credit card passing luhn check",
+			text:        "card 4111 1111 1111 1111",
+			redacted:    "card [CREDIT_CARD_1]",
+		},
+		{
+			description: "number failing luhn check",
+			text:        "order 4111 1111 1111 1112",
+			redacted:    "order 4111 1111 1111 1112",
+		},
+		{
+			description: "api key",
+			text:        "key sk-abcdefghijklmnopqrstuvwxyz12",
+			redacted:    "key [API_KEY_1]",
+		},
+		{
+			description: "custom detector",
+			detectors:   []coagent.Detector{coagent.RegexpDetector{Name: "SSN", Regexp: regexp.MustCompile(`\d{3}-\d{2}-\d{4}`)}},
+			text:        "ssn 123-45-6789 of alice@corp.com",
+			redacted:    "ssn [SSN_1] of alice@corp.com",
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			redaction := coagent.Redactor{Detectors: testcase.detectors}.NewRedaction()
+			redacted := redaction.Redact(testcase.text)
+			assert.Equal(t, testcase.redacted, redacted)
+			assert.Equal(t, testcase.text, redaction.Restore(redacted))
+		})
+	}
+}
+
+func TestRedactor_Middleware(t *testing.T) {
+	t.Parallel()
+
+	runner := coagent.Chain(
+		coagent.RunnerFunc(func(ctx context.Context, _ coagent.Agent, messages []coagent.Message, _ []coagent.RunOption) (coagent.Message, error) {
+			_, ok := coagent.RedactionFromContext(ctx)
+			assert.Equal(t, true, ok)
+
+			// Echo the text of the last message, or the placeholder of another run.
+			text := messages[len(messages)-1].Content[0].(coagent.Text).Text
+			if text == "echo" {
+				text = "[EMAIL_1]"
+			}
+
+			return coagent.Message{Role: coagent.RoleAssistant, Content: []coagent.Content{coagent.Text{Text: "got " + text}}}, nil
+		}),
+		coagent.Redactor{}.Middleware(),
+	)
+
+	testcases := []struct {
+		description string
+		text        string
+		response    string
+	}{
+		{
+			description: "restore secrets of the run",
+			text:        "my email is alice@corp.com",
+			response:    "got my email is alice@corp.com",
+		},
+		{
+			description: "not restore placeholders of other runs",
+			text:        "echo",
+			response:    "got [EMAIL_1]",
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			response, err := runner.Run(context.Background(), coagent.Agent{}, []coagent.Message{
+				{Role: coagent.RoleUser, Content: []coagent.Content{coagent.Text{Text: testcase.text}}},
+			}, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, []coagent.Content{coagent.Text{Text: testcase.response}}, response.Content)
+		})
+	}
+}
+
+func TestRedactor_Middleware_tools(t *testing.T) {
+	t.Parallel()
+
+	runner := coagent.Chain(
+		coagent.RunnerFunc(func(_ context.Context, _ coagent.Agent, messages []coagent.Message, _ []coagent.RunOption) (coagent.Message, error) {
+			assert.Equal(t, []coagent.Content{
+				coagent.ToolCall{ID: "call_1", Name: "lookup", Arguments: `{"email":"[EMAIL_1]"}`},
+				coagent.ToolResult{CallID: "call_1", Output: "[EMAIL_1] is [EMAIL_2]'s manager"},
+			}, messages[0].Content)
+
+			return coagent.Message{Role: coagent.RoleAssistant, Content: []coagent.Content{
+				coagent.ToolCall{ID: "call_2", Name: "send", Arguments: `{"to":"[EMAIL_2]"}`},
+			}}, nil
+		}),
+		coagent.Redactor{}.Middleware(),
+	)
+
+	response, err := runner.Run(context.Background(), coagent.Agent{}, []coagent.Message{
+		{Role: coagent.RoleAssistant, Content: []coagent.Content{
+			coagent.ToolCall{ID: "call_1", Name: "lookup", Arguments: `{"email":"alice@corp.com"}`},
+			coagent.ToolResult{CallID: "call_1", Output: "alice@corp.com is bob@corp.com's manager"},
+		}},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []coagent.Content{
+		coagent.ToolCall{ID: "call_2", Name: "send", Arguments: `{"to":"bob@corp.com"}`},
+	}, response.Content)
+}
+
+func TestRedactor_ReplaceAttr(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		description string
+		attr        slog.Attr
+		expected    slog.Attr
+	}{
+		{
+			description: "string",
+			attr:        slog.String("email", "alice@corp.com"),
+			expected:    slog.String("email", "[EMAIL_1]"),
+		},
+		{
+			description: "error",
+			attr:        slog.Any("error", errors.New("bad key sk-abcdefghijklmnopqrstuvwxyz")),
+			expected:    slog.String("error", "bad key [API_KEY_1]"),
+		},
+		{
+			description: "stringer",
+			attr:        slog.Any("address", stringer("alice@corp.com")),
+			expected:    slog.String("address", "[EMAIL_1]"),
+		},
+		{
+			description: "log valuer",
+			attr:        slog.Any("user", logValuer("alice@corp.com")),
+			expected:    slog.String("user", "[EMAIL_1]"),
+		},
+		{
+			description: "group",
+			attr:        slog.Group("request", slog.String("from", "alice@corp.com"), slog.Int("size", 1)),
+			expected:    slog.Group("request", slog.String("from", "[EMAIL_1]"), slog.Int("size", 1)),
+		},
+		{
+			description: "other value",
+			attr:        slog.Int("count", 4111111111111111),
+			expected:    slog.Int("count", 4111111111111111),
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			attr := coagent.Redactor{}.ReplaceAttr(nil, testcase.attr)
+			assert.Equal(t, true, testcase.expected.Equal(attr))
+		})
+	}
+}
+
+type stringer string
+
+func (s stringer) String() string {
+	return string(s)
+}
+
+type logValuer string
+
+func (v logValuer) LogValue() slog.Value {
+	return slog.StringValue(string(v))
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// Turn is a recorded run, which contains the messages sent to the Runner and the response it returned.
+type Turn struct {
+	// Messages are the messages of the run. If it's nil, the messages of the run are not verified.
+	Messages []Message
+	Response Message
+}
+
+// ReadTranscript decodes the turns of a transcript in JSON, e.g. recorded from logs of production runs.
+// The transcript is an array of turns in the format below, where messages could be omitted to skip verification,
+// and the content types are text, image (data in base64), tool_call, tool_result and raw:
+//
+//	[
+//	  {
+//	    "messages": [
+//	      {
+//	        "role": "user",
+//	        "content": [
+//	          {"type": "text", "text": "What's in the image?"},
+//	          {"type": "image", "data": "iVBORw0KGgo...", "detail": "low"}
+//	        ],
+//	        "metadata": {"key": "value"}
+//	      }
+//	    ],
+//	    "response": {
+//	      "role": "assistant",
+//	      "content": [
+//	        {"type": "tool_call", "id": "call_1", "name": "search", "arguments": "{}"},
+//	        {"type": "tool_result", "call_id": "call_1", "output": "..."},
+//	        {"type": "raw", "provider": "openai", "data": {}}
+//	      ]
+//	    }
+//	  }
+//	]
+//
+// Tools of messages could not be recorded, so they are not verified by ReplayRunner.
+//
+// Transcripts are decoded as recorded, so secrets must be redacted before they are stored,
+// e.g. by recording the messages and responses passed through Redactor.Middleware.
+func ReadTranscript(reader io.Reader) ([]Turn, error) {
+	var recorded []struct {
+		Messages []transcriptMessage `json:"messages"`
+		Response transcriptMessage   `json:"response"`
+	}
+	if err := json.NewDecoder(reader).Decode(&recorded); err != nil {
+		return nil, fmt.Errorf("decode transcript: %w", err)
+	}
+
+	transcript := make([]Turn, 0, len(recorded))
+	for i, turn := range recorded {
+		var (
+			messages []Message
+			err      error
+		)
+		if turn.Messages != nil {
+			messages = make([]Message, 0, len(turn.Messages))
+			for j, message := range turn.Messages {
+				var decoded Message
+				if decoded, err = message.decode(); err != nil {
+					return nil, fmt.Errorf("turn %d: message %d: %w", i, j, err)
+				}
+				messages = append(messages, decoded)
+			}
+		}
+		response, err := turn.Response.decode()
+		if err != nil {
+			return nil, fmt.Errorf("turn %d: response: %w", i, err)
+		}
+		transcript = append(transcript, Turn{Messages: messages, Response: response})
+	}
+
+	return transcript, nil
+}
+
+type (
+	transcriptMessage struct {
+		Role     string              `json:"role"`
+		Content  []transcriptContent `json:"content"`
+		Metadata map[string]string   `json:"metadata"`
+	}
+	transcriptContent struct {
+		Type      string          `json:"type"`
+		Text      string          `json:"text"`
+		Data      json.RawMessage `json:"data"`
+		Detail    ImageDetail     `json:"detail"`
+		ID        string          `json:"id"`
+		Name      string          `json:"name"`
+		Arguments string          `json:"arguments"`
+		CallID    string          `json:"call_id"`
+		Output    string          `json:"output"`
+		Provider  string          `json:"provider"`
+	}
+)
+
+func (m transcriptMessage) decode() (Message, error) {
+	message := Message{Role: m.Role, Metadata: m.Metadata}
+	for i, content := range m.Content {
+		switch content.Type {
+		case "text":
+			message.Content = append(message.Content, Text{Text: content.Text})
+		case "image":
+			var data []byte
+			if err := json.Unmarshal(content.Data, &data); err != nil {
+				return Message{}, fmt.Errorf("content %d: decode image: %w", i, err)
+			}
+			message.Content = append(message.Content, Image{Image: bytes.NewReader(data), Detail: content.Detail})
+		case "tool_call":
+			message.Content = append(message.Content, ToolCall{
+				ID: content.ID, Name: content.Name, Arguments: content.Arguments,
+			})
+		case "tool_result":
+			message.Content = append(message.Content, ToolResult{CallID: content.CallID, Output: content.Output})
+		case "raw":
+			message.Content = append(message.Content, RawContent{Provider: content.Provider, Data: content.Data})
+		default:
+			return Message{}, fmt.Errorf("content %d: unknown type %q: %w", i, content.Type, ErrInvalidMessage)
+		}
+	}
+
+	return message, nil
+}
+
+// ReplayRunner is a Runner that replays the recorded turns of a transcript in order
+// without calling any model, so issues could be reproduced deterministically offline.
+type ReplayRunner struct {
+	Transcript []Turn
+
+	mu   sync.Mutex
+	next int
+}
+
+func (r *ReplayRunner) Run(ctx context.Context, _ Agent, messages []Message, _ []RunOption) (Message, error) {
+	if err := ctx.Err(); err != nil {
+		return Message{}, fmt.Errorf("replay turn: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.next >= len(r.Transcript) {
+		return Message{}, ErrTranscriptExhausted
+	}
+	turn := r.Transcript[r.next]
+	if turn.Messages != nil {
+		if err := compareMessages(turn.Messages, messages); err != nil {
+			return Message{}, fmt.Errorf("turn %d: %w", r.next, err)
+		}
+	}
+	r.next++
+
+	return turn.Response, nil
+}
+
+// compareMessages returns an error wrapping ErrTranscriptMismatch which describes the first difference
+// between the recorded and actual messages. Images are compared by their detail only,
+// since their data could only be read once, and tools are not compared since they could not be recorded.
+func compareMessages(recorded, actual []Message) error {
+	for i := range max(len(recorded), len(actual)) {
+		if i >= len(recorded) {
+			return fmt.Errorf("unexpected message %d with role %s: %w", i, actual[i].Role, ErrTranscriptMismatch)
+		}
+		if i >= len(actual) {
+			return fmt.Errorf("missing message %d with role %s: %w", i, recorded[i].Role, ErrTranscriptMismatch)
+		}
+
+		expected, got := recorded[i], actual[i]
+		switch {
+		case expected.Role != got.Role:
+			return fmt.Errorf("message %d: role %s, expected %s: %w", i, got.Role, expected.Role, ErrTranscriptMismatch)
+		case !maps.Equal(expected.Metadata, got.Metadata):
+			return fmt.Errorf("message %d: metadata %v, expected %v: %w",
+				i, got.Metadata, expected.Metadata, ErrTranscriptMismatch)
+		case !slices.EqualFunc(expected.Content, got.Content, equalContent):
+			return fmt.Errorf("message %d: content %v, expected %v: %w",
+				i, got.Content, expected.Content, ErrTranscriptMismatch)
+		}
+	}
+
+	return nil
+}
+
+func equalContent(recorded, actual Content) bool {
+	if image, ok := recorded.(Image); ok {
+		other, ok := actual.(Image)
+
+		return ok && image.Detail == other.Detail
+	}
+
+	return reflect.DeepEqual(recorded, actual)
+}
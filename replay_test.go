@@ -0,0 +1,180 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ktong/coagent"
+	"github.com/ktong/coagent/internal/assert"
+)
+
+func TestReadTranscript(t *testing.T) {
+	t.Parallel()
+
+	transcript, err := coagent.ReadTranscript(strings.NewReader(`[
+		{
+			"messages": [
+				{
+					"role": "user",
+					"content": [
+						{"type": "text", "text": "What's in the image?"},
+						{"type": "image", "data": "aW1hZ2U=", "detail": "low"}
+					],
+					"metadata": {"key": "value"}
+				}
+			],
+			"response": {
+				"role": "assistant",
+				"content": [
+					{"type": "tool_call", "id": "call_1", "name": "search", "arguments": "{}"},
+					{"type": "tool_result", "call_id": "call_1", "output": "cat"},
+					{"type": "raw", "provider": "openai", "data": {"type": "refusal"}}
+				]
+			}
+		},
+		{
+			"response": {"role": "assistant", "content": [{"type": "text", "text": "A cat."}]}
+		}
+	]`))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(transcript))
+
+	image, _ := transcript[0].Messages[0].Content[1].(coagent.Image)
+	data, err := io.ReadAll(image.Image)
+	assert.NoError(t, err)
+	assert.Equal(t, "image", string(data))
+	assert.Equal(t, coagent.DetailLow, image.Detail)
+
+	assert.Equal(t, []coagent.Message{
+		{
+			Role:     coagent.RoleUser,
+			Content:  []coagent.Content{coagent.Text{Text: "What's in the image?"}, image},
+			Metadata: map[string]string{"key": "value"},
+		},
+	}, transcript[0].Messages)
+	assert.Equal(t, coagent.Message{
+		Role: coagent.RoleAssistant,
+		Content: []coagent.Content{
+			coagent.ToolCall{ID: "call_1", Name: "search", Arguments: "{}"},
+			coagent.ToolResult{CallID: "call_1", Output: "cat"},
+			coagent.RawContent{Provider: "openai", Data: json.RawMessage(`{"type": "refusal"}`)},
+		},
+	}, transcript[0].Response)
+	assert.Equal(t, coagent.Turn{
+		Response: coagent.Message{Role: coagent.RoleAssistant, Content: []coagent.Content{coagent.Text{Text: "A cat."}}},
+	}, transcript[1])
+}
+
+func TestReadTranscript_error(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		description string
+		transcript  string
+		err         string
+	}{
+		{
+			description: "invalid json",
+			transcript:  `{`,
+			err:         "decode transcript: unexpected EOF",
+		},
+		{
+			description: "unknown content type",
+			transcript:  `[{"messages": [{"role": "user", "content": [{"type": "audio"}]}]}]`,
+			err:         `turn 0: message 0: content 0: unknown type "audio": invalid message`,
+		},
+		{
+			description: "invalid image",
+			transcript:  `[{"response": {"content": [{"type": "image", "data": 1}]}}]`,
+			err: "turn 0: response: content 0: decode image: " +
+				"json: cannot unmarshal number into Go value of type []uint8",
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := coagent.ReadTranscript(strings.NewReader(testcase.transcript))
+			assert.EqualError(t, err, testcase.err)
+		})
+	}
+}
+
+func TestReplayRunner(t *testing.T) {
+	t.Parallel()
+
+	text := func(role, text string) coagent.Message {
+		return coagent.Message{Role: role, Content: []coagent.Content{coagent.Text{Text: text}}}
+	}
+	recorded := []coagent.Message{
+		text(coagent.RoleUser, "hi"),
+		{Role: coagent.RoleUser, Content: []coagent.Content{coagent.Image{Detail: coagent.DetailLow}}},
+	}
+
+	testcases := []struct {
+		description string
+		messages    []coagent.Message
+		err         string
+	}{
+		{
+			description: "same messages",
+			messages: []coagent.Message{
+				text(coagent.RoleUser, "hi"),
+				{
+					Role:    coagent.RoleUser,
+					Content: []coagent.Content{coagent.Image{Image: strings.NewReader(""), Detail: coagent.DetailLow}},
+				},
+			},
+		},
+		{
+			description: "missing message",
+			messages:    recorded[:1],
+			err:         "turn 0: missing message 1 with role user: transcript mismatch",
+		},
+		{
+			description: "unexpected message",
+			messages:    append(recorded[:2:2], text(coagent.RoleAssistant, "yo")),
+			err:         "turn 0: unexpected message 2 with role assistant: transcript mismatch",
+		},
+		{
+			description: "different role",
+			messages:    []coagent.Message{text(coagent.RoleSystem, "hi"), recorded[1]},
+			err:         "turn 0: message 0: role system, expected user: transcript mismatch",
+		},
+		{
+			description: "different text",
+			messages:    []coagent.Message{text(coagent.RoleUser, "hello"), recorded[1]},
+			err:         "turn 0: message 0: content [{<nil> hello}], expected [{<nil> hi}]: transcript mismatch",
+		},
+		{
+			description: "different image detail",
+			messages:    []coagent.Message{recorded[0], {Role: coagent.RoleUser, Content: []coagent.Content{coagent.Image{}}}},
+			err:         "turn 0: message 1: content [{<nil> <nil> }], expected [{<nil> <nil> low}]: transcript mismatch",
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			runner := &coagent.ReplayRunner{
+				Transcript: []coagent.Turn{{Messages: recorded, Response: text(coagent.RoleAssistant, "yo")}},
+			}
+			response, err := runner.Run(context.Background(), coagent.Agent{}, testcase.messages, nil)
+			if testcase.err != "" {
+				assert.EqualError(t, err, testcase.err)
+
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, text(coagent.RoleAssistant, "yo"), response)
+		})
+	}
+}
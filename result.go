@@ -0,0 +1,53 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent
+
+// RunResult is the outcome of a run in addition to the response message,
+// e.g. for applications to persist runs and correlate them with the objects on the provider side.
+type RunResult struct {
+	// RunID and ThreadID identify the run and its thread on the provider side, if the provider has them.
+	RunID    string
+	ThreadID string
+	// StopReason is the reason why the model stopped generating the response.
+	StopReason StopReason
+	Usage      Usage
+	// Messages are the messages created during the run in order, including tool calls and their results,
+	// and the response message as the last one.
+	Messages []Message
+}
+
+// Usage is the number of tokens used by a run, summed over all requests to the provider in the run.
+type Usage struct {
+	InputTokens  int
+	OutputTokens int
+}
+
+// StopReason is the reason why the model stopped generating the response.
+// Runner implementations should map the reasons of the provider to the ones defined below,
+// and pass others through as is.
+type StopReason string
+
+const (
+	// StopEndTurn means the model completed the response.
+	StopEndTurn StopReason = "end_turn"
+	// StopMaxTokens means the response reached the limit of tokens (see WithMaxTokens).
+	StopMaxTokens StopReason = "max_tokens"
+	// StopSequence means the model generated one of the stop sequences (see WithStopSequences).
+	StopSequence StopReason = "stop_sequence"
+	// StopContentFilter means the response was cut by the content filter of the provider.
+	StopContentFilter StopReason = "content_filter"
+)
+
+// WithRunResult fills the result with the outcome of the run once it's done.
+// Fields unknown to the Runner are left zero, and so are the fields of runs served without the Runner,
+// e.g. by RunCache.
+//
+// Runner implementations should fill RunConfig.Result if it's not nil, even if the run fails.
+func WithRunResult(result *RunResult) RunOption {
+	return funcOption{name: "WithRunResult", fn: func(config *RunConfig) error {
+		config.Result = result
+
+		return nil
+	}}
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ktong/coagent"
+	"github.com/ktong/coagent/internal/assert"
+)
+
+func TestWithRunResult(t *testing.T) {
+	t.Parallel()
+
+	response := coagent.Message{Role: coagent.RoleAssistant, Content: []coagent.Content{coagent.Text{Text: "yo"}}}
+	agent := coagent.Agent{
+		Name: "agent",
+		Runner: coagent.RunnerFunc(func(
+			_ context.Context, _ coagent.Agent, _ []coagent.Message, opts []coagent.RunOption,
+		) (coagent.Message, error) {
+			config, err := coagent.NewRunConfig(opts)
+			assert.NoError(t, err)
+			if config.Result != nil {
+				*config.Result = coagent.RunResult{
+					RunID:      "run",
+					StopReason: coagent.StopEndTurn,
+					Usage:      coagent.Usage{InputTokens: 10, OutputTokens: 2},
+					Messages:   []coagent.Message{response},
+				}
+			}
+
+			return response, nil
+		}),
+	}
+
+	var result coagent.RunResult
+	_, err := agent.Run(context.Background(), nil, coagent.WithRunResult(&result))
+	assert.NoError(t, err)
+	assert.Equal(t, coagent.RunResult{
+		RunID:      "run",
+		StopReason: coagent.StopEndTurn,
+		Usage:      coagent.Usage{InputTokens: 10, OutputTokens: 2},
+		Messages:   []coagent.Message{response},
+	}, result)
+}
@@ -5,16 +5,65 @@ package coagent
 
 import (
 	"context"
+	"fmt"
 	"sync/atomic"
 )
 
 // Runner Loader is the interface that wraps the Run method.
 //
 // Run executes the provided messages using the provided agent and options.
+// It must not modify the provided messages, and should return the result
+// as the response message rather than updating the inputs in place.
 type Runner interface {
 	Run(ctx context.Context, agent Agent, messages []Message, opts []RunOption) (Message, error)
 }
 
+// Capabilities describes the features supported by a Runner,
+// so callers could adapt to it instead of failing at runtime.
+type Capabilities struct {
+	Streaming         bool
+	ParallelToolCalls bool
+	ImageInput        bool
+	JSONSchemaOutput  bool
+	// MaxContextTokens is the size of the context window in tokens. Zero means it's unknown.
+	MaxContextTokens int
+}
+
+// CapabilityReporter is the interface that wraps the Capabilities method,
+// which is implemented by Runner(s) that report their supported features.
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+// RunnerCapabilities returns the capabilities of the provided runner.
+// If the runner does not implement CapabilityReporter, it returns zero Capabilities,
+// which means none of the features is known to be supported.
+func RunnerCapabilities(runner Runner) Capabilities {
+	if reporter, ok := runner.(CapabilityReporter); ok {
+		return reporter.Capabilities()
+	}
+
+	return Capabilities{}
+}
+
+// Pinger is the interface that wraps the Ping method,
+// which is implemented by Runner(s) that could verify the connectivity and credentials of the provider.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping verifies the provided runner is ready to run agents, e.g. for readiness probes of services.
+// If the runner does not implement Pinger, it's considered ready.
+func Ping(ctx context.Context, runner Runner) error {
+	if pinger, ok := runner.(Pinger); ok {
+		if err := pinger.Ping(ctx); err != nil {
+			return fmt.Errorf("ping runner: %w", err)
+		}
+	}
+
+	return nil
+}
+
 // SetDefaultRunner sets the default runner to be used by the Agent.
 // If the provided Runner is nil, the default runner is not changed.
 func SetDefaultRunner(runner Runner) {
@@ -0,0 +1,253 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent
+
+import (
+	"cmp"
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RunScheduler schedules runs across goroutines, so that batch jobs don't starve interactive traffic
+// in the same process. It enforces:
+//   - the maximum number of concurrent runs, where queued runs with higher priority (set by WithPriority)
+//     start first, and runs with the same priority start in the order they are queued.
+//     Queued runs gain priority as they wait (see AgingInterval), so runs with low priority are not starved;
+//   - the maximum rate of starting runs, e.g. to stay within the rate limits of the provider;
+//   - serialization of runs with the same key, e.g. runs on the same conversation.
+//
+// Its zero value does not limit runs. It must not be copied after first use.
+type RunScheduler struct {
+	// MaxConcurrency is the maximum number of concurrent runs. Zero means no limit.
+	MaxConcurrency int
+	// RunsPerMinute is the maximum number of runs started per minute. Zero means no limit.
+	RunsPerMinute int
+	// SerializeBy returns the key of the run. Runs with the same non-empty key run one at a time.
+	SerializeBy func(ctx context.Context, agent Agent, messages []Message) string
+	// AgingInterval is the duration a queued run waits to gain one priority.
+	// Zero means one minute, e.g. a run with priority 0 starts before new runs with priority 2
+	// after waiting for over two minutes.
+	AgingInterval time.Duration
+
+	mu        sync.Mutex
+	epoch     time.Time
+	running   int
+	waiters   waiterHeap
+	sequence  uint64
+	nextStart time.Time
+	keys      map[string]*keyLock
+}
+
+// Middleware returns a RunnerMiddleware which schedules runs by the RunScheduler.
+func (s *RunScheduler) Middleware() RunnerMiddleware {
+	return func(runner Runner) Runner {
+		return RunnerFunc(func(ctx context.Context, agent Agent, messages []Message, opts []RunOption) (Message, error) {
+			config, err := NewRunConfig(opts)
+			if err != nil {
+				return Message{}, err
+			}
+
+			if s.SerializeBy != nil {
+				if key := s.SerializeBy(ctx, agent, messages); key != "" {
+					if err = s.lock(ctx, key); err != nil {
+						return Message{}, fmt.Errorf("wait for runs of %s: %w", key, err)
+					}
+					defer s.unlock(key)
+				}
+			}
+			if err = s.acquire(ctx, config.Priority); err != nil {
+				return Message{}, fmt.Errorf("wait for concurrent runs: %w", err)
+			}
+			defer s.release()
+			if err = s.throttle(ctx); err != nil {
+				return Message{}, fmt.Errorf("wait for rate limit: %w", err)
+			}
+
+			return runner.Run(ctx, agent, messages, opts)
+		})
+	}
+}
+
+func (s *RunScheduler) acquire(ctx context.Context, priority int) error {
+	s.mu.Lock()
+	if s.MaxConcurrency <= 0 || s.running < s.MaxConcurrency && len(s.waiters) == 0 {
+		s.running++
+		s.mu.Unlock()
+
+		return nil
+	}
+	// Waiters gain priority at the same rate, so their order is fixed by the time they are queued.
+	if s.epoch.IsZero() {
+		s.epoch = time.Now()
+	}
+	waited := float64(time.Since(s.epoch)) / float64(cmp.Or(s.AgingInterval, defaultAgingInterval))
+	waiter := &waiter{rank: float64(priority) - waited, sequence: s.sequence, ready: make(chan struct{})}
+	s.sequence++
+	heap.Push(&s.waiters, waiter)
+	s.mu.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		select {
+		case <-waiter.ready:
+			// The slot was handed over while canceling, so pass it on.
+			s.releaseLocked()
+		default:
+			heap.Remove(&s.waiters, waiter.index)
+		}
+
+		return ctx.Err() //nolint:wrapcheck
+	}
+}
+
+func (s *RunScheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.releaseLocked()
+}
+
+func (s *RunScheduler) releaseLocked() {
+	if len(s.waiters) == 0 {
+		s.running--
+
+		return
+	}
+
+	waiter, _ := heap.Pop(&s.waiters).(*waiter)
+	close(waiter.ready)
+}
+
+func (s *RunScheduler) throttle(ctx context.Context) error {
+	if s.RunsPerMinute <= 0 {
+		return nil
+	}
+
+	interval := time.Minute / time.Duration(s.RunsPerMinute)
+	s.mu.Lock()
+	start := time.Now()
+	if s.nextStart.After(start) {
+		start = s.nextStart
+	}
+	s.nextStart = start.Add(interval)
+	s.mu.Unlock()
+
+	delay := time.Until(start)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Give the reserved start back, so canceled runs don't use up the rate.
+		s.mu.Lock()
+		s.nextStart = s.nextStart.Add(-interval)
+		s.mu.Unlock()
+
+		return ctx.Err() //nolint:wrapcheck
+	}
+}
+
+const defaultAgingInterval = time.Minute
+
+type keyLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+func (s *RunScheduler) lock(ctx context.Context, key string) error {
+	s.mu.Lock()
+	if s.keys == nil {
+		s.keys = make(map[string]*keyLock)
+	}
+	lock, ok := s.keys[key]
+	if !ok {
+		lock = &keyLock{ch: make(chan struct{}, 1)}
+		s.keys[key] = lock
+	}
+	lock.refs++
+	s.mu.Unlock()
+
+	select {
+	case lock.ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		s.dereference(key, lock)
+		s.mu.Unlock()
+
+		return ctx.Err() //nolint:wrapcheck
+	}
+}
+
+func (s *RunScheduler) unlock(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock := s.keys[key]
+	<-lock.ch
+	s.dereference(key, lock)
+}
+
+func (s *RunScheduler) dereference(key string, lock *keyLock) {
+	lock.refs--
+	if lock.refs == 0 {
+		delete(s.keys, key)
+	}
+}
+
+type waiter struct {
+	// rank is the priority minus the aging at the time it's queued. Higher runs first.
+	rank     float64
+	sequence uint64
+	ready    chan struct{}
+	index    int
+}
+
+type waiterHeap []*waiter
+
+func (h waiterHeap) Len() int {
+	return len(h)
+}
+
+func (h waiterHeap) Less(i, j int) bool {
+	if h[i].rank != h[j].rank {
+		return h[i].rank > h[j].rank
+	}
+
+	return h[i].sequence < h[j].sequence
+}
+
+func (h waiterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *waiterHeap) Push(x any) {
+	waiter, _ := x.(*waiter)
+	waiter.index = len(*h)
+	*h = append(*h, waiter)
+}
+
+func (h *waiterHeap) Pop() any {
+	old := *h
+	waiter := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+
+	return waiter
+}
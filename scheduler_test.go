@@ -0,0 +1,292 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ktong/coagent"
+	"github.com/ktong/coagent/internal/assert"
+)
+
+func TestRunScheduler_priority(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		description string
+		priorities  []int
+		order       []int
+	}{
+		{description: "same priority", priorities: []int{0, 0, 0}, order: []int{0, 1, 2}},
+		{description: "higher priority first", priorities: []int{0, 2, 1}, order: []int{1, 2, 0}},
+		{description: "negative priority", priorities: []int{-1, 0, -1, 1}, order: []int{3, 1, 0, 2}},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				mu    sync.Mutex
+				order []int
+			)
+			scheduler := &coagent.RunScheduler{MaxConcurrency: 1}
+			started, release := make(chan struct{}), make(chan struct{})
+			runner := coagent.Chain(
+				coagent.RunnerFunc(func(
+					ctx context.Context, _ coagent.Agent, _ []coagent.Message, _ []coagent.RunOption,
+				) (coagent.Message, error) {
+					if index, ok := ctx.Value(runIndexKey{}).(int); ok {
+						mu.Lock()
+						order = append(order, index)
+						mu.Unlock()
+					} else {
+						close(started)
+						<-release
+					}
+
+					return coagent.Message{}, nil
+				}),
+				scheduler.Middleware(),
+			)
+
+			// Hold the only slot, so the following runs are queued.
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				_, err := runner.Run(context.Background(), coagent.Agent{}, nil, nil)
+				assert.NoError(t, err)
+			}()
+			<-started
+			for i, priority := range testcase.priorities {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					ctx := context.WithValue(context.Background(), runIndexKey{}, i)
+					_, err := runner.Run(ctx, coagent.Agent{}, nil, []coagent.RunOption{coagent.WithPriority(priority)})
+					assert.NoError(t, err)
+				}()
+				waitQueued(scheduler, i+1)
+			}
+			close(release)
+			wg.Wait()
+
+			assert.Equal(t, testcase.order, order)
+		})
+	}
+}
+
+func TestRunScheduler_cancel(t *testing.T) {
+	t.Parallel()
+
+	scheduler := &coagent.RunScheduler{MaxConcurrency: 1}
+	started, release := make(chan struct{}), make(chan struct{})
+	runner := coagent.Chain(
+		coagent.RunnerFunc(func(ctx context.Context, _ coagent.Agent, _ []coagent.Message, _ []coagent.RunOption) (coagent.Message, error) {
+			if ctx.Value(runIndexKey{}) == nil {
+				close(started)
+				<-release
+			}
+
+			return coagent.Message{}, nil
+		}),
+		scheduler.Middleware(),
+	)
+
+	held := make(chan error)
+	go func() {
+		_, err := runner.Run(context.Background(), coagent.Agent{}, nil, nil)
+		held <- err
+	}()
+
+	// Queue a run once the slot is held, then cancel it.
+	<-started
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), runIndexKey{}, 0))
+	canceled := make(chan error)
+	go func() {
+		_, err := runner.Run(ctx, coagent.Agent{}, nil, nil)
+		canceled <- err
+	}()
+	waitQueued(scheduler, 1)
+	cancel()
+	err := <-canceled
+	assert.Equal(t, true, errors.Is(err, context.Canceled))
+	assert.Equal(t, 0, scheduler.QueuedRuns())
+
+	// The canceled run must not take the slot.
+	close(release)
+	assert.NoError(t, <-held)
+	_, err = runner.Run(context.WithValue(context.Background(), runIndexKey{}, 1), coagent.Agent{}, nil, nil)
+	assert.NoError(t, err)
+}
+
+func TestRunScheduler_serialize(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		description string
+		keys        []string
+		concurrent  int
+	}{
+		{description: "same key", keys: []string{"a", "a", "a"}, concurrent: 1},
+		{description: "different keys", keys: []string{"a", "b", "c"}, concurrent: 3},
+		{description: "no key", keys: []string{"", "", ""}, concurrent: 3},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				mu                  sync.Mutex
+				running, concurrent int
+			)
+			scheduler := &coagent.RunScheduler{
+				SerializeBy: func(ctx context.Context, _ coagent.Agent, _ []coagent.Message) string {
+					key, _ := ctx.Value(runIndexKey{}).(string)
+
+					return key
+				},
+			}
+			runner := coagent.Chain(
+				coagent.RunnerFunc(func(context.Context, coagent.Agent, []coagent.Message, []coagent.RunOption) (coagent.Message, error) {
+					mu.Lock()
+					running++
+					concurrent = max(concurrent, running)
+					mu.Unlock()
+
+					// Wait for the other runs until they could overlap.
+					deadline := time.Now().Add(100 * time.Millisecond)
+					for time.Now().Before(deadline) {
+						mu.Lock()
+						overlapped := concurrent == len(testcase.keys)
+						mu.Unlock()
+						if overlapped {
+							break
+						}
+						runtime.Gosched()
+					}
+
+					mu.Lock()
+					running--
+					mu.Unlock()
+
+					return coagent.Message{}, nil
+				}),
+				scheduler.Middleware(),
+			)
+
+			var wg sync.WaitGroup
+			for _, key := range testcase.keys {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					_, err := runner.Run(context.WithValue(context.Background(), runIndexKey{}, key), coagent.Agent{}, nil, nil)
+					assert.NoError(t, err)
+				}()
+			}
+			wg.Wait()
+
+			assert.Equal(t, testcase.concurrent, concurrent)
+		})
+	}
+}
+
+type runIndexKey struct{}
+
+// waitQueued waits until the scheduler has the number of queued runs.
+func waitQueued(scheduler *coagent.RunScheduler, queued int) {
+	for scheduler.QueuedRuns() != queued {
+		runtime.Gosched()
+	}
+}
+
+func TestRunScheduler_aging(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu    sync.Mutex
+		order []int
+	)
+	scheduler := &coagent.RunScheduler{MaxConcurrency: 1, AgingInterval: time.Millisecond}
+	started, release := make(chan struct{}), make(chan struct{})
+	runner := coagent.Chain(
+		coagent.RunnerFunc(func(ctx context.Context, _ coagent.Agent, _ []coagent.Message, _ []coagent.RunOption) (coagent.Message, error) {
+			if index, ok := ctx.Value(runIndexKey{}).(int); ok {
+				mu.Lock()
+				order = append(order, index)
+				mu.Unlock()
+			} else {
+				close(started)
+				<-release
+			}
+
+			return coagent.Message{}, nil
+		}),
+		scheduler.Middleware(),
+	)
+
+	var wg sync.WaitGroup
+	run := func(ctx context.Context, priority int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := runner.Run(ctx, coagent.Agent{}, nil, []coagent.RunOption{coagent.WithPriority(priority)})
+			assert.NoError(t, err)
+		}()
+	}
+	run(context.Background(), 0)
+	<-started
+
+	// The run with low priority has waited longer than the difference of priorities.
+	run(context.WithValue(context.Background(), runIndexKey{}, 0), 0)
+	waitQueued(scheduler, 1)
+	time.Sleep(5 * time.Millisecond)
+	run(context.WithValue(context.Background(), runIndexKey{}, 1), 2)
+	waitQueued(scheduler, 2)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, []int{0, 1}, order)
+}
+
+func TestRunScheduler_throttle(t *testing.T) {
+	t.Parallel()
+
+	const interval = 20 * time.Millisecond
+	scheduler := &coagent.RunScheduler{RunsPerMinute: int(time.Minute / interval)}
+	runner := coagent.Chain(
+		coagent.RunnerFunc(func(context.Context, coagent.Agent, []coagent.Message, []coagent.RunOption) (coagent.Message, error) {
+			return coagent.Message{}, nil
+		}),
+		scheduler.Middleware(),
+	)
+
+	start := time.Now()
+	_, err := runner.Run(context.Background(), coagent.Agent{}, nil, nil)
+	assert.NoError(t, err)
+
+	// Canceled runs give their starts back.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for range 10 {
+		_, err = runner.Run(ctx, coagent.Agent{}, nil, nil)
+		assert.Equal(t, true, errors.Is(err, context.Canceled))
+	}
+
+	_, err = runner.Run(context.Background(), coagent.Agent{}, nil, nil)
+	assert.NoError(t, err)
+	elapsed := time.Since(start)
+	assert.Equal(t, true, elapsed >= interval && elapsed < 5*interval)
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Session is a conversation with an Agent, which owns the history of messages.
+//
+// It's safe to use a Session concurrently. Runs of the same Session are serialized
+// in the order they are called, so the history is never corrupted by concurrent runs.
+type Session struct {
+	agent Agent
+
+	mu       sync.Mutex
+	messages []Message
+	tail     chan struct{} // closed when the last queued run is done.
+}
+
+// NewSession returns a Session with the agent, which continues the conversation of the provided history.
+func NewSession(agent Agent, history ...Message) *Session {
+	tail := make(chan struct{})
+	close(tail)
+
+	return &Session{agent: agent, messages: slices.Clone(history), tail: tail}
+}
+
+// Messages returns a copy of the history of messages in the Session.
+func (s *Session) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.messages)
+}
+
+// Run appends the message to the history and runs the agent with the entire history
+// after the runs called before are done. The response is appended to the history as well.
+// If the run fails, the history is not changed.
+func (s *Session) Run(ctx context.Context, message Message, opts ...RunOption) (Message, error) {
+	return s.run(ctx, s.enqueue(), message, opts)
+}
+
+// Enqueue queues the run of the message like Run but returns immediately,
+// with a Future to wait for the response.
+func (s *Session) Enqueue(ctx context.Context, message Message, opts ...RunOption) *Future {
+	turn := s.enqueue()
+	future := &Future{done: make(chan struct{})}
+	go func() {
+		defer close(future.done)
+
+		future.message, future.err = s.run(ctx, turn, message, opts)
+	}()
+
+	return future
+}
+
+type sessionTurn struct {
+	previous <-chan struct{}
+	done     chan struct{}
+}
+
+func (s *Session) enqueue() sessionTurn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	turn := sessionTurn{previous: s.tail, done: make(chan struct{})}
+	s.tail = turn.done
+
+	return turn
+}
+
+func (s *Session) run(ctx context.Context, turn sessionTurn, message Message, opts []RunOption) (Message, error) {
+	select {
+	case <-turn.previous:
+		defer close(turn.done)
+	case <-ctx.Done():
+		// Keep the order of the following runs.
+		go func() {
+			<-turn.previous
+			close(turn.done)
+		}()
+
+		return Message{}, fmt.Errorf("wait for previous runs: %w", ctx.Err())
+	}
+
+	messages := append(s.Messages(), message)
+	response, err := s.agent.Run(ctx, messages, opts...)
+	if err != nil {
+		return Message{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, message, response)
+
+	return response, nil
+}
+
+// Future is the response of a run queued by Session.Enqueue.
+type Future struct {
+	done    chan struct{}
+	message Message
+	err     error
+}
+
+// Done returns a channel which is closed when the run is done.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait waits for the run to be done and returns its response.
+func (f *Future) Wait(ctx context.Context) (Message, error) {
+	select {
+	case <-f.done:
+		return f.message, f.err
+	case <-ctx.Done():
+		return Message{}, fmt.Errorf("wait for run: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2024 the authors
+// Use of this source code is governed by a MIT license found in the LICENSE file.
+
+package coagent_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/ktong/coagent"
+	"github.com/ktong/coagent/internal/assert"
+)
+
+func TestSession(t *testing.T) {
+	t.Parallel()
+
+	text := func(role, text string) coagent.Message {
+		return coagent.Message{Role: role, Content: []coagent.Content{coagent.Text{Text: text}}}
+	}
+	errRun := errors.New("run failed")
+
+	testcases := []struct {
+		description string
+		history     []coagent.Message
+		questions   []string
+		messages    []string
+	}{
+		{
+			description: "ordered runs",
+			questions:   []string{"0", "1", "2", "3"},
+			messages:    []string{"0", "re 1: 0", "1", "re 3: 1", "2", "re 5: 2", "3", "re 7: 3"},
+		},
+		{
+			description: "with history",
+			history:     []coagent.Message{text(coagent.RoleUser, "hi"), text(coagent.RoleAssistant, "yo")},
+			questions:   []string{"0", "1"},
+			messages:    []string{"hi", "yo", "0", "re 3: 0", "1", "re 5: 1"},
+		},
+		{
+			description: "failed run",
+			questions:   []string{"0", "fail", "1"},
+			messages:    []string{"0", "re 1: 0", "1", "re 3: 1"},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.description, func(t *testing.T) {
+			t.Parallel()
+
+			agent := coagent.Agent{
+				Name: "agent",
+				// Respond with the number of messages and the last question, which shows the order of runs.
+				Runner: coagent.RunnerFunc(func(
+					_ context.Context, _ coagent.Agent, messages []coagent.Message, _ []coagent.RunOption,
+				) (coagent.Message, error) {
+					question, _ := messages[len(messages)-1].Content[0].(coagent.Text)
+					if question.Text == "fail" {
+						return coagent.Message{}, errRun
+					}
+
+					return text(coagent.RoleAssistant, "re "+strconv.Itoa(len(messages))+": "+question.Text), nil
+				}),
+			}
+			session := coagent.NewSession(agent, testcase.history...)
+
+			futures := make([]*coagent.Future, 0, len(testcase.questions))
+			for _, question := range testcase.questions {
+				futures = append(futures, session.Enqueue(context.Background(), text(coagent.RoleUser, question)))
+			}
+			for i, future := range futures {
+				_, err := future.Wait(context.Background())
+				assert.Equal(t, testcase.questions[i] == "fail", errors.Is(err, errRun))
+			}
+
+			var messages []string
+			for _, message := range session.Messages() {
+				content, _ := message.Content[0].(coagent.Text)
+				messages = append(messages, content.Text)
+			}
+			assert.Equal(t, testcase.messages, messages)
+		})
+	}
+}
@@ -3,8 +3,43 @@
 
 package coagent
 
-import "github.com/ktong/coagent/internal/embedded"
+import (
+	"reflect"
+	"slices"
+
+	"github.com/ktong/coagent/internal/embedded"
+)
 
 type Tool interface {
 	embedded.Tool
 }
+
+// EffectiveTools returns the tools available to the model in a run of the agent with the messages and options,
+// which Runner implementations should follow and is useful for debugging:
+//   - the tools of the agent, or the tools of the overrides instead if any (see WithOverrides);
+//   - followed by the tools attached to the messages in order, which take effect for the entire run.
+//
+// Duplicated tools, which are deeply equal, are only kept at their first occurrence.
+func EffectiveTools(agent Agent, messages []Message, opts []RunOption) ([]Tool, error) {
+	config, err := NewRunConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	tools := agent.Tools
+	if config.Overrides.Tools != nil {
+		tools = config.Overrides.Tools
+	}
+	for _, message := range messages {
+		tools = append(slices.Clip(tools), message.Tools...)
+	}
+
+	var effective []Tool
+	for _, tool := range tools {
+		if !slices.ContainsFunc(effective, func(t Tool) bool { return reflect.DeepEqual(t, tool) }) {
+			effective = append(effective, tool)
+		}
+	}
+
+	return effective, nil
+}